@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Assertion is an expected Check outcome for a tuple, loaded from the model assertions file.
+type Assertion struct {
+	Tuple
+	Expected bool `json:"expected"`
+}
+
+// Expectation is an expected Check outcome for a tuple given in code, e.g. that the seeded admin tuple really
+// grants admin. It is the same as an Assertion of the assertions file.
+type Expectation = Assertion
+
+// AssertionsFile returns the path of the assertions companion file of a model file,
+// e.g. "model_assertions.json" next to "model.fga".
+func AssertionsFile(modelFile string) string {
+	return strings.TrimSuffix(modelFile, filepath.Ext(modelFile)) + "_assertions.json"
+}
+
+// LoadAssertions reads a JSON list of assertions from the given file.
+func LoadAssertions(path string) ([]Assertion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read assertions file")
+	}
+	var assertions []Assertion
+	if err := json.Unmarshal(data, &assertions); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal assertions file %s", path)
+	}
+	return assertions, nil
+}
+
+// RunAssertions checks every assertion against the loaded model and tuples and returns an error listing
+// the assertions that did not match.
+func (fga *OpenFGAServer) RunAssertions(ctx context.Context, assertions []Assertion) error {
+	var failed []string
+	for _, a := range assertions {
+		allowed, err := fga.Check(ctx, a.Tuple)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check assertion %s#%s@%s", a.Object, a.Relation, a.User)
+		}
+		if allowed != a.Expected {
+			failed = append(failed, fmt.Sprintf("%s#%s@%s: expected %v, got %v", a.Object, a.Relation, a.User, a.Expected, allowed))
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("%d of %d assertions failed: %s", len(failed), len(assertions), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// SelfTest checks the expectations against the seeded tuples and returns an error listing the ones that did not
+// match, it catches a model and tuples mismatch before it surfaces as a wrong decision. See also WithSelfTest.
+func (fga *OpenFGAServer) SelfTest(ctx context.Context, expectations []Expectation) error {
+	if err := fga.RunAssertions(ctx, expectations); err != nil {
+		return errors.Wrap(err, "self test failed")
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// batchCheckSize is the maximum number of checks the server accepts in a single BatchCheckRequest.
+const batchCheckSize = 5000
+
+// BatchCheckItem is one check of a batch, each check can carry its own contextual tuples and condition context.
+type BatchCheckItem struct {
+	Tuple                           // Tuple is the checked tuple
+	ContextualTuples []Tuple        // ContextualTuples are considered as written for this check only, e.g. runtime group memberships
+	Context          map[string]any // Context is the condition context of this check, e.g. {"current_time": "2024-01-01T10:00:00Z"}
+}
+
+// BatchResult is the outcome of one of the items of BatchCheckResults.
+type BatchResult struct {
+	Tuple   Tuple // Tuple is the checked tuple of the item as passed by the caller
+	Allowed bool  // Allowed is the decision, false when Err is set
+	Err     error // Err is the error of this check only, the other checks of the batch are not affected
+}
+
+// BatchCheckResults checks the items with BatchCheck requests of at most batchCheckSize items against the
+// current model. The results keep the order of the items, so they can be zipped with the caller's objects.
+// The returned error is set when a whole request fails, the errors of single checks are reported in the results.
+func (fga *OpenFGAServer) BatchCheckResults(ctx context.Context, items []BatchCheckItem) ([]BatchResult, error) {
+	results := make([]BatchResult, 0, len(items))
+	modelID := fga.ActiveModelID()
+	for start := 0; start < len(items); start += batchCheckSize {
+		batch := items[start:min(start+batchCheckSize, len(items))]
+		checks := make([]*openfgav1.BatchCheckItem, 0, len(batch))
+		for i, item := range batch {
+			check, err := item.batchCheckItem(strconv.Itoa(i))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid batch check item %s", item.Tuple)
+			}
+			checks = append(checks, check)
+		}
+		release, err := fga.limiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		fga.stats.checks.Add(1)
+		r, err := fga.reader().BatchCheck(ctx, &openfgav1.BatchCheckRequest{
+			StoreId:              fga.StoreID,
+			AuthorizationModelId: modelID,
+			Checks:               checks,
+		})
+		release()
+		if err != nil {
+			fga.stats.checkErrors.Add(1)
+			return nil, errors.Wrap(err, "failed to batch check tuples in OpenFGA")
+		}
+		for i, item := range batch {
+			result := BatchResult{Tuple: item.Tuple}
+			single, ok := r.GetResult()[strconv.Itoa(i)]
+			switch {
+			case !ok:
+				result.Err = errors.New("no result returned for the tuple")
+			case single.GetError() != nil:
+				result.Err = errors.Errorf("failed to check tuple: %s", single.GetError().GetMessage())
+			default:
+				result.Allowed = single.GetAllowed()
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// BatchCheck is BatchCheckResults returning the decisions keyed by the tuple string (see Tuple.String),
+// it fails with the first error of a single check. When the same tuple is checked with different contexts,
+// the last decision wins: use BatchCheckResults instead.
+func (fga *OpenFGAServer) BatchCheck(ctx context.Context, items []BatchCheckItem) (map[string]bool, error) {
+	results, err := fga.BatchCheckResults(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	decisions := make(map[string]bool, len(results))
+	for _, result := range results {
+		if result.Err != nil {
+			return nil, errors.Wrapf(result.Err, "failed to check %s", result.Tuple)
+		}
+		decisions[result.Tuple.String()] = result.Allowed
+	}
+	return decisions, nil
+}
+
+// batchCheckItem converts the item to the OpenFGA BatchCheckItem with the given correlation ID.
+func (item BatchCheckItem) batchCheckItem(correlationID string) (*openfgav1.BatchCheckItem, error) {
+	check := &openfgav1.BatchCheckItem{
+		TupleKey:      item.CheckRequestTupleKey(),
+		CorrelationId: correlationID,
+	}
+	if len(item.ContextualTuples) > 0 {
+		keys := make([]*openfgav1.TupleKey, 0, len(item.ContextualTuples))
+		for _, t := range item.ContextualTuples {
+			tk, err := t.TupleKey()
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid contextual tuple")
+			}
+			keys = append(keys, tk)
+		}
+		check.ContextualTuples = &openfgav1.ContextualTupleKeys{TupleKeys: keys}
+	}
+	if item.Context != nil {
+		checkContext, err := structpb.NewStruct(item.Context)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid condition context")
+		}
+		check.Context = checkContext
+	}
+	return check, nil
+}
+
+// CheckUsers checks which of the users have the relation with the object in BatchCheck requests, e.g. "of these
+// users, who is an editor of this document?". The decisions are keyed by user, it fails with the first error of
+// a single check.
+func (fga *OpenFGAServer) CheckUsers(ctx context.Context, object, relation string, users []string) (map[string]bool, error) {
+	items := make([]BatchCheckItem, 0, len(users))
+	for _, user := range users {
+		items = append(items, BatchCheckItem{Tuple: Tuple{Object: object, Relation: relation, User: user}})
+	}
+	return fga.checkKeyed(ctx, items, func(t Tuple) string { return t.User })
+}
+
+// CheckObjects checks which of the objects the user has the relation with in BatchCheck requests, e.g. "which of
+// these documents can this user view?". The decisions are keyed by object, it fails with the first error of a
+// single check, e.g. a conditioned tuple whose condition needs a context: use BatchCheckResults for those.
+func (fga *OpenFGAServer) CheckObjects(ctx context.Context, objects []string, relation, user string) (map[string]bool, error) {
+	items := make([]BatchCheckItem, 0, len(objects))
+	for _, object := range objects {
+		items = append(items, BatchCheckItem{Tuple: Tuple{Object: object, Relation: relation, User: user}})
+	}
+	return fga.checkKeyed(ctx, items, func(t Tuple) string { return t.Object })
+}
+
+// checkKeyed is BatchCheck returning the decisions keyed by the key of the tuples.
+func (fga *OpenFGAServer) checkKeyed(ctx context.Context, items []BatchCheckItem, key func(Tuple) string) (map[string]bool, error) {
+	results, err := fga.BatchCheckResults(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	decisions := make(map[string]bool, len(results))
+	for _, result := range results {
+		if result.Err != nil {
+			return nil, errors.Wrapf(result.Err, "failed to check %s", result.Tuple)
+		}
+		decisions[key(result.Tuple)] = result.Allowed
+	}
+	return decisions, nil
+}
+
+// AccessMatrix checks every relation of every user with every object, e.g. for the permissions matrix of an admin
+// dashboard, in BatchCheck requests of at most batchCheckSize checks instead of one Check per cell. The decisions
+// are keyed by object, relation and user, it fails with the first error of a single check.
+func (fga *OpenFGAServer) AccessMatrix(ctx context.Context, objects []string, relations []string, users []string) (map[string]map[string]map[string]bool, error) {
+	items := make([]BatchCheckItem, 0, len(objects)*len(relations)*len(users))
+	for _, object := range objects {
+		for _, relation := range relations {
+			for _, user := range users {
+				items = append(items, BatchCheckItem{Tuple: Tuple{Object: object, Relation: relation, User: user}})
+			}
+		}
+	}
+	results, err := fga.BatchCheckResults(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	matrix := make(map[string]map[string]map[string]bool, len(objects))
+	for _, result := range results {
+		if result.Err != nil {
+			return nil, errors.Wrapf(result.Err, "failed to check %s", result.Tuple)
+		}
+		t := result.Tuple
+		if matrix[t.Object] == nil {
+			matrix[t.Object] = make(map[string]map[string]bool, len(relations))
+		}
+		if matrix[t.Object][t.Relation] == nil {
+			matrix[t.Object][t.Relation] = make(map[string]bool, len(users))
+		}
+		matrix[t.Object][t.Relation][t.User] = result.Allowed
+	}
+	return matrix, nil
+}
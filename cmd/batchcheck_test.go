@@ -0,0 +1,138 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBatchCheckResults(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	items := []BatchCheckItem{
+		{Tuple: Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}},
+		{Tuple: Tuple{Object: "document:2", Relation: "viewer", User: "user:test@example.com"}},
+		{Tuple: Tuple{Object: "document:1", Relation: "owner", User: "user:test@example.com"}},
+		{Tuple: Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}},
+	}
+	results, err := fga.BatchCheckResults(t.Context(), items)
+	if err != nil {
+		t.Fatalf("failed to batch check: %+v", err)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("expected %d results, got %d", len(items), len(results))
+	}
+	for i, want := range []bool{true, false, false, true} {
+		if results[i].Tuple.ID() != items[i].Tuple.ID() {
+			t.Errorf("result %d is for %s, want %s", i, results[i].Tuple, items[i].Tuple)
+		}
+		if results[i].Allowed != want {
+			t.Errorf("result %d: allowed=%v, want %v", i, results[i].Allowed, want)
+		}
+	}
+	// the relation is not defined in the model
+	if results[2].Err == nil {
+		t.Error("expected an error for the undefined relation")
+	}
+	if results[0].Err != nil || results[1].Err != nil {
+		t.Errorf("expected the other checks to succeed, got %+v, %+v", results[0].Err, results[1].Err)
+	}
+
+	if _, err := fga.BatchCheck(t.Context(), items); err == nil {
+		t.Error("expected the map variant to fail on the undefined relation")
+	}
+	decisions, err := fga.BatchCheck(t.Context(), items[:2])
+	if err != nil {
+		t.Fatalf("failed to batch check: %+v", err)
+	}
+	if !decisions["document:1#viewer@user:test@example.com"] || decisions["document:2#viewer@user:test@example.com"] {
+		t.Errorf("unexpected decisions %+v", decisions)
+	}
+}
+
+func TestCheckUsers(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:alice"},
+		{Object: "document:1", Relation: "editor", User: "user:carol"},
+	})
+	decisions, err := fga.CheckUsers(t.Context(), "document:1", "editor", []string{"user:alice", "user:bob", "user:carol"})
+	if err != nil {
+		t.Fatalf("failed to check users: %+v", err)
+	}
+	if want := map[string]bool{"user:alice": true, "user:bob": false, "user:carol": true}; !reflect.DeepEqual(decisions, want) {
+		t.Errorf("CheckUsers() = %v, want %v", decisions, want)
+	}
+	if _, err := fga.CheckUsers(t.Context(), "document:1", "owner", []string{"user:alice"}); err == nil {
+		t.Error("expected an error for the undefined relation")
+	}
+}
+
+func TestCheckObjects(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:alice"},
+		{Object: "document:3", Relation: "viewer", User: "user:*"},
+	})
+	decisions, err := fga.CheckObjects(t.Context(), []string{"document:1", "document:2", "document:3"}, "viewer", "user:alice")
+	if err != nil {
+		t.Fatalf("failed to check objects: %+v", err)
+	}
+	if want := map[string]bool{"document:1": true, "document:2": false, "document:3": true}; !reflect.DeepEqual(decisions, want) {
+		t.Errorf("CheckObjects() = %v, want %v", decisions, want)
+	}
+	if _, err := fga.CheckObjects(t.Context(), []string{"document:1"}, "owner", "user:alice"); err == nil {
+		t.Error("expected an error for the undefined relation")
+	}
+}
+
+func TestAccessMatrix(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:alice"},
+		{Object: "document:2", Relation: "viewer", User: "user:bob"},
+	})
+	matrix, err := fga.AccessMatrix(t.Context(), []string{"document:1", "document:2"}, []string{"viewer", "editor"}, []string{"user:alice", "user:bob"})
+	if err != nil {
+		t.Fatalf("failed to build the access matrix: %+v", err)
+	}
+	want := map[string]map[string]map[string]bool{
+		"document:1": {
+			"viewer": {"user:alice": true, "user:bob": false},
+			"editor": {"user:alice": true, "user:bob": false},
+		},
+		"document:2": {
+			"viewer": {"user:alice": false, "user:bob": true},
+			"editor": {"user:alice": false, "user:bob": false},
+		},
+	}
+	if !reflect.DeepEqual(matrix, want) {
+		t.Errorf("AccessMatrix() = %v, want %v", matrix, want)
+	}
+	if _, err := fga.AccessMatrix(t.Context(), []string{"document:1"}, []string{"owner"}, []string{"user:alice"}); err == nil {
+		t.Error("expected an error for the undefined relation")
+	}
+}
+
+func TestBatchCheckItemContext(t *testing.T) {
+	fga := newTestOpenFGA(t, conditionModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:daytime@example.com", Condition: "business_hours"},
+	})
+	daytime := Tuple{Object: "document:1", Relation: "viewer", User: "user:daytime@example.com"}
+	guest := Tuple{Object: "document:2", Relation: "viewer", User: "user:guest@example.com"}
+	items := []BatchCheckItem{
+		{Tuple: daytime, Context: map[string]any{"current_time": "2024-01-01T10:00:00Z"}},
+		{Tuple: daytime, Context: map[string]any{"current_time": "2024-01-01T20:00:00Z"}},
+		{Tuple: guest, ContextualTuples: []Tuple{guest}},
+		{Tuple: guest},
+	}
+	results, err := fga.BatchCheckResults(t.Context(), items)
+	if err != nil {
+		t.Fatalf("failed to batch check: %+v", err)
+	}
+	for i, want := range []bool{true, false, true, false} {
+		if results[i].Err != nil || results[i].Allowed != want {
+			t.Errorf("result %d: allowed=%v, err=%+v, want %v", i, results[i].Allowed, results[i].Err, want)
+		}
+	}
+	if _, err := fga.BatchCheckResults(t.Context(), []BatchCheckItem{{Tuple: guest, Context: map[string]any{"invalid": make(chan int)}}}); err == nil {
+		t.Error("expected an error for a context that cannot be converted")
+	}
+}
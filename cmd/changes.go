@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// Change is a tuple write or delete read from the changelog of the store.
+type Change struct {
+	Tuple
+	Deleted   bool      // Deleted is true when the tuple was deleted, false when it was written
+	Timestamp time.Time // Timestamp is the time of the change
+}
+
+// ReadChanges returns a page of the changelog after continuationToken (empty to read from the start) and the
+// token of the next page. A non-empty objectType only returns the changes of that type, e.g. "document" for a
+// cache invalidator that does not care about the other types. At the end of the changelog the page is empty.
+func (fga *OpenFGAServer) ReadChanges(ctx context.Context, objectType, continuationToken string) ([]Change, string, error) {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+	r, err := fga.Server.ReadChanges(ctx, &openfgav1.ReadChangesRequest{
+		StoreId:           fga.StoreID,
+		Type:              objectType,
+		PageSize:          wrapperspb.Int32(readPageSize),
+		ContinuationToken: continuationToken,
+	})
+	if err != nil {
+		return nil, "", errors.Wrap(err, "failed to read changes from OpenFGA")
+	}
+	changes := make([]Change, 0, len(r.GetChanges()))
+	for _, change := range r.GetChanges() {
+		changes = append(changes, Change{
+			Tuple:     embeddfga.FromTupleKey(change.GetTupleKey()),
+			Deleted:   change.GetOperation() == openfgav1.TupleOperation_TUPLE_OPERATION_DELETE,
+			Timestamp: change.GetTimestamp().AsTime(),
+		})
+	}
+	return changes, r.GetContinuationToken(), nil
+}
+
+// changelogCursor is the position in the changelog StoreLastModified read up to, so each call only reads the
+// changes written since the previous one.
+type changelogCursor struct {
+	mu    sync.Mutex
+	token string    // token is the continuation token after the last read change
+	last  time.Time // last is the timestamp of the latest change read
+}
+
+// StoreLastModified returns the time of the latest tuple write or delete of the store, or of the latest update of
+// the store itself when that is later. When several processes share a datastore, the writes of one process are
+// only seen by the caches of the others after their TTL: an external coordinator can poll StoreLastModified in
+// every process and, when it moves past the previous value without a local write, call Refresh and drop the
+// application's own caches of the decisions. The changelog is read incrementally, the first call reads all of it.
+// Writes of authorization models do not move it, Refresh detects them.
+func (fga *OpenFGAServer) StoreLastModified(ctx context.Context) (time.Time, error) {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	store, err := fga.Server.GetStore(ctx, &openfgav1.GetStoreRequest{StoreId: fga.StoreID})
+	release()
+	if err != nil {
+		if notFound := notFoundError(err); notFound != nil {
+			return time.Time{}, errors.Wrapf(notFound, "failed to get store: %s", err)
+		}
+		return time.Time{}, errors.Wrap(err, "failed to get store")
+	}
+	c := &fga.changelog
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		changes, token, err := fga.ReadChanges(ctx, "", c.token)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for _, change := range changes {
+			if change.Timestamp.After(c.last) {
+				c.last = change.Timestamp
+			}
+		}
+		if token != "" {
+			c.token = token
+		}
+		if len(changes) < readPageSize {
+			break
+		}
+	}
+	if updated := store.GetUpdatedAt().AsTime(); updated.After(c.last) {
+		return updated, nil
+	}
+	return c.last, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReadChanges(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "group:admins", Relation: "member", User: "user:test@example.com"},
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+		{Object: "document:2", Relation: "viewer", User: "group:admins#member"},
+	})
+	if err := fga.Delete(t.Context(), []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}); err != nil {
+		t.Fatalf("failed to delete tuple: %+v", err)
+	}
+
+	all, _, err := fga.ReadChanges(t.Context(), "", "")
+	if err != nil {
+		t.Fatalf("failed to read changes: %+v", err)
+	}
+	if len(all) != 4 {
+		t.Errorf("expected 4 changes without a type filter, got %+v", all)
+	}
+
+	changes, token, err := fga.ReadChanges(t.Context(), "document", "")
+	if err != nil {
+		t.Fatalf("failed to read document changes: %+v", err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 document changes, got %+v", changes)
+	}
+	for _, change := range changes {
+		if change.Object == "group:admins" {
+			t.Errorf("did not expect a group change, got %+v", change)
+		}
+	}
+	if last := changes[len(changes)-1]; !last.Deleted || last.Object != "document:1" {
+		t.Errorf("expected the last change to be the deletion of document:1, got %+v", last)
+	}
+
+	next, _, err := fga.ReadChanges(t.Context(), "document", token)
+	if err != nil {
+		t.Fatalf("failed to read the next page: %+v", err)
+	}
+	if len(next) != 0 {
+		t.Errorf("expected no more document changes, got %+v", next)
+	}
+}
+
+func TestStoreLastModified(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	first, err := fga.StoreLastModified(t.Context())
+	if err != nil {
+		t.Fatalf("failed to read the last modification: %+v", err)
+	}
+	if first.IsZero() {
+		t.Fatal("expected the seeded tuple to set the last modification")
+	}
+	if again, err := fga.StoreLastModified(t.Context()); err != nil || !again.Equal(first) {
+		t.Errorf("expected the last modification to stay %s without writes, got %s, %+v", first, again, err)
+	}
+
+	// another process sharing the datastore writes a tuple
+	other, err := NewOpenFGA(fga.dataStoreURI,
+		WithInitialTuples([]Tuple{{Object: "document:2", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(fga.ModelFile),
+		WithStoreName(fga.StoreName),
+		WithAuthorizationModelName("default"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create the other OpenFGA server: %+v", err)
+	}
+	defer other.Close()
+	if other.StoreID != fga.StoreID {
+		t.Fatalf("expected the other server to share the store %s, got %s", fga.StoreID, other.StoreID)
+	}
+	last, err := fga.StoreLastModified(t.Context())
+	if err != nil {
+		t.Fatalf("failed to read the last modification: %+v", err)
+	}
+	if !last.After(first) {
+		t.Errorf("expected the write of the other process to move the last modification past %s, got %s", first, last)
+	}
+}
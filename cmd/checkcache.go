@@ -0,0 +1,97 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// checkCacheMaxEntries bounds the number of cached Check decisions, the least recently used one is evicted first.
+const checkCacheMaxEntries = 10000
+
+// checkCacheKey identifies a cached Check decision.
+type checkCacheKey struct {
+	modelID string
+	tuple   TupleID
+}
+
+// checkCacheEntry is a cached Check decision valid until expiresAt.
+type checkCacheEntry struct {
+	key       checkCacheKey
+	allowed   bool
+	expiresAt time.Time
+}
+
+// checkCache caches the Check decisions of the object types configured with WithPerTypeCacheTTL.
+type checkCache struct {
+	mu         sync.Mutex
+	entries    map[checkCacheKey]*list.Element // entries index the elements of lru
+	lru        list.List                       // lru holds the checkCacheEntry values, most recently used first
+	gen        uint64                          // gen is incremented by invalidate, see generation
+	maxEntries int                             // maxEntries overrides checkCacheMaxEntries in the tests
+}
+
+// generation returns the current generation of the cache, it must be read before sending the Check whose
+// decision is passed to set.
+func (c *checkCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+// get returns the cached decision for the key, expired entries are dropped.
+func (c *checkCache) get(key checkCacheKey) (allowed bool, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return false, false
+	}
+	entry := e.Value.(checkCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+		return false, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.allowed, true
+}
+
+// set caches the decision for the key during ttl, a ttl of 0 does not cache it. A decision of a generation
+// invalidated since is not cached, it may predate the write that invalidated the cache.
+func (c *checkCache) set(key checkCacheKey, allowed bool, ttl time.Duration, gen uint64) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[checkCacheKey]*list.Element)
+	}
+	entry := checkCacheEntry{key: key, allowed: allowed, expiresAt: time.Now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	maxEntries := c.maxEntries
+	if maxEntries == 0 {
+		maxEntries = checkCacheMaxEntries
+	}
+	for c.lru.Len() > maxEntries {
+		delete(c.entries, c.lru.Remove(c.lru.Back()).(checkCacheEntry).key)
+	}
+}
+
+// invalidate drops all the cached decisions, it is called after each write through the server.
+func (c *checkCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	clear(c.entries)
+	c.lru.Init()
+}
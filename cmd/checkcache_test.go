@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+func TestWithPerTypeCacheTTL(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "group:admins", Relation: "member", User: "user:other@example.com"},
+	}, WithPerTypeCacheTTL(map[string]time.Duration{
+		"group":    0,
+		"document": time.Hour,
+	}))
+	member := Tuple{Object: "group:admins", Relation: "member", User: "user:test@example.com"}
+	viewer := Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}
+	for _, tpl := range []Tuple{member, viewer} {
+		if allowed, err := fga.Check(t.Context(), tpl); err != nil || allowed {
+			t.Fatalf("expected %s to be denied, got %v, %+v", tpl, allowed, err)
+		}
+	}
+
+	// write behind the back of the wrapper, e.g. another process sharing the datastore
+	_, err := fga.Server.Write(t.Context(), &openfgav1.WriteRequest{
+		StoreId:              fga.StoreID,
+		AuthorizationModelId: fga.ActiveModelID(),
+		Writes: &openfgav1.WriteRequestWrites{
+			TupleKeys: []*openfgav1.TupleKey{
+				{Object: member.Object, Relation: member.Relation, User: member.User},
+				{Object: viewer.Object, Relation: viewer.Relation, User: viewer.User},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to write tuples: %+v", err)
+	}
+	if allowed, err := fga.Check(t.Context(), member); err != nil || !allowed {
+		t.Errorf("expected the uncached group check to be allowed, got %v, %+v", allowed, err)
+	}
+	if allowed, err := fga.Check(t.Context(), viewer); err != nil || allowed {
+		t.Errorf("expected the cached document check to be still denied, got %v, %+v", allowed, err)
+	}
+
+	// a write through the wrapper drops the cached decisions
+	if err := fga.Write(t.Context(), []Tuple{{Object: "document:2", Relation: "editor", User: "user:test@example.com"}}, false); err != nil {
+		t.Fatalf("failed to write tuple: %+v", err)
+	}
+	if allowed, err := fga.Check(t.Context(), viewer); err != nil || !allowed {
+		t.Errorf("expected the document check to be allowed after the write, got %v, %+v", allowed, err)
+	}
+}
+
+func TestCheckCacheExpiry(t *testing.T) {
+	var c checkCache
+	key := checkCacheKey{modelID: "model", tuple: Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}.ID()}
+	c.set(key, true, 0, c.generation())
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected a zero TTL not to cache the decision")
+	}
+	c.set(key, true, 20*time.Millisecond, c.generation())
+	if allowed, ok := c.get(key); !ok || !allowed {
+		t.Fatalf("expected the cached decision, got %v, %v", allowed, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.get(key); ok {
+		t.Error("expected the decision to expire")
+	}
+}
+
+func TestCheckCacheStaleGeneration(t *testing.T) {
+	var c checkCache
+	key := checkCacheKey{modelID: "model", tuple: Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}.ID()}
+	// a Check in flight while a write invalidates the cache
+	gen := c.generation()
+	c.invalidate()
+	c.set(key, false, time.Hour, gen)
+	if _, ok := c.get(key); ok {
+		t.Error("expected the decision of an invalidated generation not to be cached")
+	}
+	c.set(key, true, time.Hour, c.generation())
+	if allowed, ok := c.get(key); !ok || !allowed {
+		t.Errorf("expected the decision of the current generation, got %v, %v", allowed, ok)
+	}
+}
+
+func TestCheckCacheBound(t *testing.T) {
+	c := checkCache{maxEntries: 2}
+	keys := make([]checkCacheKey, 3)
+	for i := range keys {
+		keys[i] = checkCacheKey{modelID: "model", tuple: Tuple{Object: fmt.Sprintf("document:%d", i), Relation: "viewer", User: "user:test@example.com"}.ID()}
+	}
+	c.set(keys[0], true, time.Hour, c.generation())
+	c.set(keys[1], true, time.Hour, c.generation())
+	// keys[0] becomes the most recently used, keys[1] is evicted by keys[2]
+	if _, ok := c.get(keys[0]); !ok {
+		t.Fatal("expected the first decision to be cached")
+	}
+	c.set(keys[2], true, time.Hour, c.generation())
+	for i, want := range []bool{true, false, true} {
+		if _, ok := c.get(keys[i]); ok != want {
+			t.Errorf("expected the decision %d to be cached: %v, got %v", i, want, ok)
+		}
+	}
+}
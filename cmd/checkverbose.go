@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+)
+
+const (
+	datastoreQueryCountTag = "datastore_query_count" // datastoreQueryCountTag is the request tag of the datastore query count of a Check
+	dispatchCountTag       = "dispatch_count"        // dispatchCountTag is the request tag of the dispatch count of a Check
+)
+
+// CheckResult is a Check decision with the metadata of its evaluation, see CheckVerbose.
+type CheckResult struct {
+	Allowed            bool          // Allowed is the decision
+	NoDatastoreQueries bool          // NoDatastoreQueries is set when the decision was answered without a datastore query, usually by a cache, see CheckVerbose
+	DatastoreQueries   uint32        // DatastoreQueries is the number of datastore queries of the evaluation, 0 for a cached decision
+	Dispatches         uint32        // Dispatches is the number of sub-problems the evaluation was dispatched to
+	Duration           time.Duration // Duration is the time the Check took
+}
+
+// CheckVerbose is Check reporting whether the decision needed datastore queries, to measure the effectiveness of
+// the caches and tune CacheTTL with real data. The counts are approximate, for sampling: they are read from the
+// request tags OpenFGA sets for its own logging through the deprecated grpc_ctxtags package, an internal detail
+// which may change with an OpenFGA upgrade. NoDatastoreQueries usually means a cache answered, the check query
+// cache, the check iterator cache or PerTypeCacheTTL, which OpenFGA does not tell apart. It is also set for a
+// decision which needs no query, e.g. from the contextual tuples alone, and when OpenFGA no longer sets the tags.
+func (fga *OpenFGAServer) CheckVerbose(ctx context.Context, t Tuple) (CheckResult, error) {
+	// the OpenFGA server records the query and dispatch counts of the Check in the request tags
+	tags := grpc_ctxtags.NewTags()
+	start := time.Now()
+	allowed, err := fga.check(grpc_ctxtags.SetInContext(ctx, tags), fga.ActiveModelID(), t, nil)
+	if err != nil {
+		return CheckResult{}, err
+	}
+	result := CheckResult{Allowed: allowed, Duration: time.Since(start)}
+	queries, evaluated := tags.Values()[datastoreQueryCountTag].(float64)
+	dispatches, _ := tags.Values()[dispatchCountTag].(float64)
+	result.DatastoreQueries = uint32(queries)
+	result.Dispatches = uint32(dispatches)
+	// without the tag the decision was answered by the PerTypeCacheTTL cache, OpenFGA was not called
+	result.NoDatastoreQueries = !evaluated || queries == 0
+	return result, nil
+}
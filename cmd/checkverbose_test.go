@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckVerbose(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "group:eng", Relation: "member", User: "user:test@example.com"},
+		{Object: "document:1", Relation: "viewer", User: "group:eng#member"},
+	})
+	viewer := Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}
+	first, err := fga.CheckVerbose(t.Context(), viewer)
+	if err != nil {
+		t.Fatalf("failed to check: %+v", err)
+	}
+	if !first.Allowed || first.NoDatastoreQueries || first.DatastoreQueries == 0 {
+		t.Errorf("expected a fresh allowed decision, got %+v", first)
+	}
+	second, err := fga.CheckVerbose(t.Context(), viewer)
+	if err != nil {
+		t.Fatalf("failed to check: %+v", err)
+	}
+	if !second.Allowed || !second.NoDatastoreQueries || second.DatastoreQueries != 0 {
+		t.Errorf("expected a cached allowed decision, got %+v", second)
+	}
+
+	// the decisions of the per-type cache never reach OpenFGA
+	fga = newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:test@example.com"},
+	}, WithPerTypeCacheTTL(map[string]time.Duration{"document": time.Hour}))
+	if r, err := fga.CheckVerbose(t.Context(), viewer); err != nil || r.NoDatastoreQueries {
+		t.Errorf("expected a fresh decision, got %+v, %+v", r, err)
+	}
+	if r, err := fga.CheckVerbose(t.Context(), viewer); err != nil || !r.Allowed || !r.NoDatastoreQueries {
+		t.Errorf("expected a cached allowed decision, got %+v, %+v", r, err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrServerBusy is returned by the methods sending requests to the OpenFGA server or the datastore when
+// WithMaxConcurrentRequests is reached and the requests are not queued (see WithRequestQueueing).
+var ErrServerBusy = errors.New("server busy: too many concurrent requests")
+
+// requestLimiter bounds the number of concurrent requests sent to the OpenFGA server, a nil limiter is unbounded.
+type requestLimiter struct {
+	sem   *semaphore.Weighted
+	queue bool // queue makes acquire wait for a free slot instead of failing with ErrServerBusy
+}
+
+func newRequestLimiter(n int64, queue bool) *requestLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &requestLimiter{sem: semaphore.NewWeighted(n), queue: queue}
+}
+
+// acquire takes a request slot, the returned function releases it. When queueing, it waits until a slot is free
+// or ctx is done.
+func (l *requestLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if l.queue {
+		if err := l.sem.Acquire(ctx, 1); err != nil {
+			return nil, errors.Wrap(err, "failed to wait for a free request slot")
+		}
+	} else if !l.sem.TryAcquire(1) {
+		return nil, ErrServerBusy
+	}
+	return func() { l.sem.Release(1) }, nil
+}
+
+// lockWrites takes the write lock of the server, the returned function releases it. sqlite has a single writer,
+// the concurrent writes of the server would otherwise contend for the database lock and fail with a busy error
+// once the retries of the sqlite storage are exhausted. It waits until the lock is free or ctx is done.
+func (fga *OpenFGAServer) lockWrites(ctx context.Context) (func(), error) {
+	if err := fga.writeSem.Acquire(ctx, 1); err != nil {
+		return nil, errors.Wrap(err, "failed to wait for the pending writes")
+	}
+	return func() { fga.writeSem.Release(1) }, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	l := newRequestLimiter(1, false)
+	release, err := l.acquire(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire(t.Context()); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("expected ErrServerBusy when the limit is reached, got %+v", err)
+	}
+	release()
+	release, err = l.acquire(t.Context())
+	if err != nil {
+		t.Fatalf("expected a free slot after release, got %+v", err)
+	}
+	release()
+
+	queued := newRequestLimiter(1, true)
+	release, err = queued.acquire(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := queued.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the queued request to wait until the deadline, got %+v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	if release, err = queued.acquire(t.Context()); err != nil {
+		t.Fatalf("expected the queued request to get the released slot, got %+v", err)
+	}
+	release()
+
+	var unbounded *requestLimiter
+	if release, err := unbounded.acquire(t.Context()); err != nil {
+		t.Errorf("expected a nil limiter to be unbounded, got %+v", err)
+	} else {
+		release()
+	}
+}
+
+func TestWithMaxConcurrentRequests(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}, WithMaxConcurrentRequests(1), WithRequestQueueing(false))
+	release, err := fga.limiter.acquire(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}
+	if _, err := fga.Check(t.Context(), tpl); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("expected Check to fail with ErrServerBusy, got %+v", err)
+	}
+	if _, err := fga.ListObjects(t.Context(), "document", "viewer", "user:test@example.com"); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("expected ListObjects to fail with ErrServerBusy, got %+v", err)
+	}
+	for name, call := range map[string]func() error{
+		"Delete": func() error { return fga.Delete(t.Context(), []Tuple{tpl}) },
+		"Apply":  func() error { return fga.Apply(t.Context(), []Tuple{tpl}, nil) },
+		"BatchCheckResults": func() error {
+			_, err := fga.BatchCheckResults(t.Context(), []BatchCheckItem{{Tuple: tpl}})
+			return err
+		},
+		"ObjectExists": func() error {
+			_, err := fga.ObjectExists(t.Context(), "document:1")
+			return err
+		},
+		"SnapshotTuples": func() error {
+			_, err := fga.SnapshotTuples(t.Context())
+			return err
+		},
+		"ReadChanges": func() error {
+			_, _, err := fga.ReadChanges(t.Context(), "", "")
+			return err
+		},
+		"sweeper": func() error {
+			_, err := fga.deleteExpiredGrants(t.Context(), time.Now())
+			return err
+		},
+	} {
+		if err := call(); !errors.Is(err, ErrServerBusy) {
+			t.Errorf("expected %s to fail with ErrServerBusy, got %+v", name, err)
+		}
+	}
+	release()
+	if allowed, err := fga.Check(t.Context(), tpl); err != nil || !allowed {
+		t.Errorf("expected Check to succeed once the slot is released, got %v, %+v", allowed, err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentWrites issues Writes, Applies and Deletes from many goroutines, as concurrent web handlers do,
+// none of them may fail because of the single sqlite writer.
+func TestConcurrentWrites(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	const workers, iterations = 64, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*iterations*3)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				object := fmt.Sprintf("document:%d-%d", w, i)
+				viewer := Tuple{Object: object, Relation: "viewer", User: "user:viewer@example.com"}
+				editor := Tuple{Object: object, Relation: "editor", User: "user:viewer@example.com"}
+				if err := fga.Write(t.Context(), []Tuple{viewer}, false); err != nil {
+					errs <- err
+					continue
+				}
+				if err := fga.Apply(t.Context(), []Tuple{editor}, []Tuple{viewer}); err != nil {
+					errs <- err
+					continue
+				}
+				if err := fga.Delete(t.Context(), []Tuple{editor}); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write failed: %+v", err)
+	}
+	if n, err := fga.CountTuples(t.Context()); err != nil || n != 1 {
+		t.Errorf("expected only the initial tuple to remain, got %d, %+v", n, err)
+	}
+}
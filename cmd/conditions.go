@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+)
+
+// ContextFromRequest builds the condition context of a Check from the request headers, mapping maps each
+// condition parameter to the header holding its value, e.g. {"user_ip": "X-Forwarded-For"}. Missing headers
+// are left out so the conditions report them as missing parameters. The values are strings, OpenFGA converts
+// them to the parameter type (e.g. ipaddress or timestamp), and the map is accepted as is by structpb.NewStruct.
+func ContextFromRequest(r *http.Request, mapping map[string]string) map[string]any {
+	conditionContext := make(map[string]any, len(mapping))
+	for param, header := range mapping {
+		if value := r.Header.Get(header); value != "" {
+			conditionContext[param] = value
+		}
+	}
+	return conditionContext
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestContextFromRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/docs/1", nil)
+	r.Header.Set("X-Forwarded-For", "10.0.0.1")
+	r.Header.Set("X-Department", "engineering")
+
+	conditionContext := ContextFromRequest(r, map[string]string{
+		"user_ip":    "X-Forwarded-For",
+		"department": "x-department",
+		"now":        "X-Request-Time",
+	})
+	if len(conditionContext) != 2 || conditionContext["user_ip"] != "10.0.0.1" || conditionContext["department"] != "engineering" {
+		t.Fatalf("unexpected condition context %+v", conditionContext)
+	}
+	if _, err := structpb.NewStruct(conditionContext); err != nil {
+		t.Errorf("expected the condition context to convert to a struct, got %+v", err)
+	}
+}
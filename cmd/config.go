@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigSnapshot is the effective configuration of a running OpenFGAServer, as resolved from the options, the
+// environment and the defaults. The datastore URIs have their credentials redacted.
+type ConfigSnapshot struct {
+	StoreName              string         `json:"store_name"`
+	StoreID                string         `json:"store_id"`
+	AuthorizationModelName string         `json:"authorization_model_name"`
+	AuthorizationModelID   string         `json:"authorization_model_id"`
+	SchemaVersion          string         `json:"schema_version"`
+	ModelFile              string         `json:"model_file"`
+	ModelDir               string         `json:"model_dir,omitempty"`
+	DatastoreURI           string         `json:"datastore_uri,omitempty"`
+	ReadReplicaURI         string         `json:"read_replica_uri,omitempty"`
+	CacheTTL               ConfigDuration `json:"cache_ttl"`
+	CheckQueryCacheLimit   uint32         `json:"check_query_cache_limit"`
+	MaxEvaluationCost      int            `json:"max_evaluation_cost"`
+	MaxConcurrentRequests  int64          `json:"max_concurrent_requests"`
+	ConnMaxIdleTime        ConfigDuration `json:"conn_max_idle_time"`
+}
+
+// ConfigDuration is a duration of the ConfigSnapshot, marshaled to JSON in the time.Duration format, e.g. "5m0s",
+// instead of nanoseconds.
+type ConfigDuration time.Duration
+
+// MarshalJSON marshals the duration as its string, e.g. "5m0s".
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses a duration marshaled by MarshalJSON.
+func (d *ConfigDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ConfigDuration(parsed)
+	return nil
+}
+
+// Config returns a snapshot of the effective configuration, e.g. to tell what a deployed instance resolved
+// from its environment variables.
+func (fga *OpenFGAServer) Config() ConfigSnapshot {
+	return ConfigSnapshot{
+		StoreName:              fga.StoreNamePrefix + fga.StoreName,
+		StoreID:                fga.StoreID,
+		AuthorizationModelName: fga.AuthorizationModelName,
+		AuthorizationModelID:   fga.ActiveModelID(),
+		SchemaVersion:          fga.SchemaVersion(),
+		ModelFile:              fga.ModelFile,
+		ModelDir:               fga.ModelDir,
+		DatastoreURI:           embeddfga.RedactURI(fga.dataStoreURI),
+		ReadReplicaURI:         embeddfga.RedactURI(fga.ReadReplicaURI),
+		CacheTTL:               ConfigDuration(fga.CacheTTL),
+		CheckQueryCacheLimit:   fga.CheckQueryCacheLimit,
+		MaxEvaluationCost:      fga.MaxEvaluationCost,
+		MaxConcurrentRequests:  fga.MaxConcurrentRequests,
+		ConnMaxIdleTime:        ConfigDuration(fga.ConnMaxIdleTime),
+	}
+}
+
+// ConfigHandler answers with the Config snapshot as JSON. It is meant for operators, so register it behind an
+// admin permission.
+func (fga *OpenFGAServer) ConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, fga.Config())
+}
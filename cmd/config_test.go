@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConfig(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}, WithStoreNamePrefix("tenant_"), WithMaxEvaluationCost(200))
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/config", fga.ConfigHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/config", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	var got ConfigSnapshot
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := `"cache_ttl":"10m0s"`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected the durations to be marshaled as strings, e.g. %s, got %s", want, w.Body.String())
+	}
+	if got != fga.Config() {
+		t.Errorf("expected the handler to answer with Config(), got %+v", got)
+	}
+	if got.StoreName != "tenant_test_store" || got.StoreID != fga.StoreID || got.AuthorizationModelID != fga.ActiveModelID() ||
+		got.MaxEvaluationCost != 200 || got.DatastoreURI != fga.dataStoreURI {
+		t.Errorf("unexpected config snapshot %+v", got)
+	}
+}
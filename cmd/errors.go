@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrStoreNotFound is returned when the store does not exist anymore, e.g. it was deleted by another process.
+	ErrStoreNotFound = errors.New("store not found")
+	// ErrModelNotFound is returned when the authorization model does not exist in the store, e.g. a stale model
+	// ID after the model was updated elsewhere. Calling Refresh binds the server to the latest model.
+	ErrModelNotFound = errors.New("authorization model not found")
+	// ErrObjectNotFound is returned by CheckObject when the access is denied and no tuple names the object, so
+	// the object is unknown rather than forbidden.
+	ErrObjectNotFound = errors.New("object not found")
+	// ErrListObjectsDeadlineExceeded is returned by ListObjects with the objects found until the ListObjectsDeadline
+	// was hit, the result is likely partial. OpenFGA does not report it, see ListObjects for its detection.
+	ErrListObjectsDeadlineExceeded = errors.New("list objects deadline exceeded")
+	// ErrGrantExists is returned by GrantTemporary when the tuple is already granted, temporarily or not. OpenFGA
+	// cannot overwrite a tuple, delete it with Delete first to grant it again with a new TTL.
+	ErrGrantExists = errors.New("tuple already granted")
+)
+
+// notFoundError maps the OpenFGA not-found errors to ErrStoreNotFound and ErrModelNotFound, it returns nil for
+// any other error.
+func notFoundError(err error) error {
+	switch status.Code(err) {
+	case codes.Code(openfgav1.NotFoundErrorCode_store_id_not_found):
+		return ErrStoreNotFound
+	case codes.Code(openfgav1.ErrorCode_authorization_model_not_found),
+		codes.Code(openfgav1.ErrorCode_latest_authorization_model_not_found):
+		return ErrModelNotFound
+	}
+	return nil
+}
+
+// checkNotFoundError classifies a Check error like notFoundError. Check resolves the model without looking up the
+// store, so a missing model is confirmed against the store to tell a deleted store from a stale model ID.
+func (fga *OpenFGAServer) checkNotFoundError(ctx context.Context, err error) error {
+	notFound := notFoundError(err)
+	if !errors.Is(notFound, ErrModelNotFound) {
+		return notFound
+	}
+	if _, storeErr := fga.reader().GetStore(ctx, &openfgav1.GetStoreRequest{StoreId: fga.StoreID}); errors.Is(notFoundError(storeErr), ErrStoreNotFound) {
+		return ErrStoreNotFound
+	}
+	return notFound
+}
+
+// writeError wraps the error of a Write request with msg. A write blocked on a locked sqlite datastore past the
+// deadline of the context fails with an OpenFGA status, the context error is returned instead, so the callers can
+// tell the timeout with errors.Is(err, context.DeadlineExceeded).
+func writeError(ctx context.Context, err error, msg string) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return errors.Wrapf(ctxErr, "%s: %s", msg, err)
+	}
+	return errors.Wrap(err, msg)
+}
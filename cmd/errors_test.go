@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckModelNotFound(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl})
+
+	// a well-formed model ID that does not exist in the store
+	_, err := fga.CheckAgainstModel(t.Context(), "01ARZ3NDEKTSV4RRFFQ69G5FAV", tpl)
+	if !errors.Is(err, ErrModelNotFound) {
+		t.Fatalf("expected ErrModelNotFound, got %+v", err)
+	}
+	if errors.Is(err, ErrStoreNotFound) {
+		t.Errorf("did not expect ErrStoreNotFound, got %+v", err)
+	}
+}
+
+func TestCheckStoreNotFound(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl})
+	fga.StoreID = "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+
+	_, err := fga.Check(t.Context(), tpl)
+	if !errors.Is(err, ErrStoreNotFound) {
+		t.Fatalf("expected ErrStoreNotFound, got %+v", err)
+	}
+	if err := fga.Refresh(t.Context()); !errors.Is(err, ErrStoreNotFound) {
+		t.Errorf("expected Refresh to return ErrStoreNotFound, got %+v", err)
+	}
+}
+
+func TestCheckObjectNotFound(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl})
+
+	if allowed, err := fga.CheckObject(t.Context(), tpl); err != nil || !allowed {
+		t.Errorf("expected the access to be allowed, got %v, %+v", allowed, err)
+	}
+	if allowed, err := fga.CheckObject(t.Context(), Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}); err != nil || allowed {
+		t.Errorf("expected the access to a known object to be denied, got %v, %+v", allowed, err)
+	}
+	if _, err := fga.CheckObject(t.Context(), Tuple{Object: "document:2", Relation: "editor", User: "user:test@example.com"}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %+v", err)
+	}
+}
+
+func TestWriteDeadlineOnLockedDatastore(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}})
+	db, err := sql.Open("sqlite", fga.dataStoreURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// hold the write lock of the datastore
+	if _, err := conn.ExecContext(t.Context(), "BEGIN IMMEDIATE"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = conn.ExecContext(context.Background(), "ROLLBACK") }()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+	tpl := Tuple{Object: "document:2", Relation: "editor", User: "user:test@example.com"}
+	if err := fga.Write(ctx, []Tuple{tpl}, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Write to fail with context.DeadlineExceeded, got %+v", err)
+	}
+	if err := fga.Delete(ctx, []Tuple{tpl}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Delete to fail with context.DeadlineExceeded, got %+v", err)
+	}
+}
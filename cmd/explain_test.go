@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const explainModel = `model
+  schema 1.1
+
+type user
+type group
+   relations
+		define member: [user]
+type folder
+   relations
+		define viewer: [user, group#member]
+type document
+   relations
+		define parent: [folder]
+		define editor: [user]
+		define viewer: [user, user:*, group#member] or editor or viewer from parent
+`
+
+func TestExplainAccess(t *testing.T) {
+	fga := newTestOpenFGA(t, explainModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:direct"},
+		{Object: "document:1", Relation: "editor", User: "user:editor"},
+		{Object: "group:eng", Relation: "member", User: "user:member"},
+		{Object: "document:1", Relation: "viewer", User: "group:eng#member"},
+		{Object: "folder:f", Relation: "viewer", User: "group:eng#member"},
+		{Object: "document:2", Relation: "parent", User: "folder:f"},
+		{Object: "document:3", Relation: "viewer", User: "user:*"},
+	})
+	for name, tc := range map[string]struct {
+		object, user string
+		want         AccessExplanation
+	}{
+		"direct": {object: "document:1", user: "user:direct", want: AccessExplanation{Allowed: true, Direct: true, Path: []AccessStep{
+			{Object: "document:1", Relation: "viewer", Kind: AccessDirect},
+		}}},
+		"wildcard": {object: "document:3", user: "user:anyone", want: AccessExplanation{Allowed: true, Direct: true, Path: []AccessStep{
+			{Object: "document:3", Relation: "viewer", Kind: AccessWildcard},
+		}}},
+		"computed": {object: "document:1", user: "user:editor", want: AccessExplanation{Allowed: true, Path: []AccessStep{
+			{Object: "document:1", Relation: "viewer", Kind: AccessComputed},
+			{Object: "document:1", Relation: "editor", Kind: AccessDirect},
+		}}},
+		"userset": {object: "document:1", user: "user:member", want: AccessExplanation{Allowed: true, Path: []AccessStep{
+			{Object: "document:1", Relation: "viewer", Kind: AccessUserset},
+			{Object: "group:eng", Relation: "member", Kind: AccessDirect},
+		}}},
+		"tuple to userset": {object: "document:2", user: "user:member", want: AccessExplanation{Allowed: true, Path: []AccessStep{
+			{Object: "document:2", Relation: "viewer", Kind: AccessTupleToUserset},
+			{Object: "folder:f", Relation: "viewer", Kind: AccessUserset},
+			{Object: "group:eng", Relation: "member", Kind: AccessDirect},
+		}}},
+		"denied": {object: "document:2", user: "user:direct", want: AccessExplanation{}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := fga.ExplainAccess(t.Context(), tc.object, "viewer", tc.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("ExplainAccess() = %+v, want %+v", *got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCheckWithTrace(t *testing.T) {
+	fga := newTestOpenFGA(t, explainModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:editor"},
+	})
+	for user, want := range map[string]struct {
+		allowed bool
+		trace   string
+	}{
+		"user:editor": {allowed: true, trace: "document:1#viewer (computed) -> document:1#editor (direct) @ user:editor"},
+		"user:nobody": {trace: "document:1#viewer: no tuple resolves to user:nobody"},
+	} {
+		allowed, trace, err := fga.CheckWithTrace(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: user})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != want.allowed || trace != want.trace {
+			t.Errorf("CheckWithTrace(%s) = %v, %q, want %v, %q", user, allowed, trace, want.allowed, want.trace)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/oklog/ulid/v2"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/server/commands"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/sqlcommon"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/pkg/errors"
+)
+
+// TimedTuple is a tuple with the time it was originally granted, see ImportWithTimestamps.
+type TimedTuple struct {
+	Tuple               // Tuple is the imported tuple
+	Timestamp time.Time // Timestamp is the original grant time, returned as the tuple timestamp by the OpenFGA Read
+}
+
+// ImportWithTimestamps is an advanced migration helper writing tuples migrated from another system with their
+// original grant time, e.g. to keep the audit trail. The OpenFGA API always stamps a tuple with the time of the
+// write, so the tuples are validated like a Write, then inserted in the sqlite datastore directly: it is not
+// available with an injected datastore. The import is atomic, all the tuples are inserted in a single transaction
+// under the write lock, or none on error. The changelog (ReadChanges) still records the time of the import.
+func (fga *OpenFGAServer) ImportWithTimestamps(ctx context.Context, tuples []TimedTuple) error {
+	if fga.db == nil {
+		return errors.New("importing with timestamps requires the sqlite datastore, not an injected one")
+	}
+	if len(tuples) == 0 {
+		return errors.New("no tuples provided to import")
+	}
+	writer := &timestampWriter{OpenFGADatastore: fga.datastore, db: fga.db, timestamps: make(map[TupleID]time.Time, len(tuples))}
+	tupleKeys := make([]*openfgav1.TupleKey, 0, len(tuples))
+	for _, t := range tuples {
+		if err := t.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tuple")
+		}
+		if t.Timestamp.IsZero() {
+			return errors.Errorf("timestamp of tuple %s cannot be zero", t.Tuple)
+		}
+		tk, err := t.TupleKey()
+		if err != nil {
+			return errors.Wrap(err, "invalid tuple")
+		}
+		writer.timestamps[t.ID()] = t.Timestamp.UTC()
+		tupleKeys = append(tupleKeys, tk)
+	}
+
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	fga.stats.writes.Add(1)
+	// the Write command of the API validates the tuples against the model, then hands them to the writer
+	_, err = commands.NewWriteCommand(writer).Execute(ctx, &openfgav1.WriteRequest{
+		StoreId:              fga.StoreID,
+		AuthorizationModelId: fga.ActiveModelID(),
+		Writes:               &openfgav1.WriteRequestWrites{TupleKeys: tupleKeys},
+	})
+	fga.checkCache.invalidate()
+	if err != nil {
+		fga.stats.writeErrors.Add(1)
+		return errors.Wrap(err, "failed to import tuples with timestamps")
+	}
+	return nil
+}
+
+// timestampWriter is the sqlite datastore inserting the written tuples with their timestamps instead of the
+// current time, all in a single transaction.
+type timestampWriter struct {
+	storage.OpenFGADatastore
+	db         *sql.DB
+	timestamps map[TupleID]time.Time
+}
+
+// MaxTuplesPerWrite lets the whole import through the Write command, it is a single transaction.
+func (w *timestampWriter) MaxTuplesPerWrite() int {
+	return len(w.timestamps)
+}
+
+func (w *timestampWriter) Write(ctx context.Context, store string, deletes storage.Deletes, writes storage.Writes, _ ...storage.TupleWriteOption) error {
+	if len(deletes) > 0 {
+		return errors.New("deletes are not supported by the timestamp import")
+	}
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin import transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, tk := range writes {
+		objectType, objectID := tuple.SplitObject(tk.GetObject())
+		userObjectType, userObjectID, userRelation := tuple.ToUserParts(tk.GetUser())
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM tuple WHERE store = ? AND object_type = ?
+			AND object_id = ? AND relation = ? AND user_object_type = ? AND user_object_id = ? AND user_relation = ?)`,
+			store, objectType, objectID, tk.GetRelation(), userObjectType, userObjectID, userRelation).Scan(&exists); err != nil {
+			return errors.Wrapf(err, "failed to look up tuple %s", tuple.TupleKeyToString(tk))
+		}
+		if exists {
+			return storage.InvalidWriteInputError(tk, openfgav1.TupleOperation_TUPLE_OPERATION_WRITE)
+		}
+		conditionName, conditionContext, err := sqlcommon.MarshalRelationshipCondition(tk.GetCondition())
+		if err != nil {
+			return err
+		}
+		id := ulid.Make().String()
+		timestamp := w.timestamps[TupleID{Object: tk.GetObject(), Relation: tk.GetRelation(), User: tk.GetUser()}]
+		if _, err := tx.ExecContext(ctx, `INSERT INTO tuple (store, object_type, object_id, relation, user_object_type,
+			user_object_id, user_relation, user_type, condition_name, condition_context, ulid, inserted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			store, objectType, objectID, tk.GetRelation(), userObjectType, userObjectID, userRelation,
+			string(tuple.GetUserTypeFromUser(tk.GetUser())), conditionName, conditionContext, id, timestamp); err != nil {
+			return errors.Wrapf(err, "failed to insert tuple %s", tuple.TupleKeyToString(tk))
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO changelog (store, object_type, object_id, relation,
+			user_object_type, user_object_id, user_relation, condition_name, condition_context, operation, ulid,
+			inserted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, datetime('subsec'))`,
+			store, objectType, objectID, tk.GetRelation(), userObjectType, userObjectID, userRelation,
+			conditionName, conditionContext, int32(openfgav1.TupleOperation_TUPLE_OPERATION_WRITE), id); err != nil {
+			return errors.Wrapf(err, "failed to record tuple %s in the changelog", tuple.TupleKeyToString(tk))
+		}
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit the imported tuples")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+func TestImportWithTimestamps(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	granted := time.Date(2019, 3, 14, 15, 9, 26, 0, time.UTC)
+	imported := []TimedTuple{
+		{Tuple: Tuple{Object: "document:2", Relation: "viewer", User: "user:test@example.com"}, Timestamp: granted},
+		{Tuple: Tuple{Object: "document:2", Relation: "editor", User: "group:eng#member"}, Timestamp: granted.Add(time.Hour)},
+	}
+	if err := fga.ImportWithTimestamps(t.Context(), imported); err != nil {
+		t.Fatalf("failed to import tuples: %+v", err)
+	}
+	stored, err := fga.readStoredTuples(t.Context(), &openfgav1.ReadRequestTupleKey{Object: "document:2"})
+	if err != nil {
+		t.Fatalf("failed to read tuples: %+v", err)
+	}
+	timestamps := map[string]time.Time{}
+	for _, st := range stored {
+		timestamps[st.GetKey().GetRelation()] = st.GetTimestamp().AsTime()
+	}
+	for _, it := range imported {
+		if got := timestamps[it.Relation]; !got.Equal(it.Timestamp) {
+			t.Errorf("expected the timestamp %s for %s, got %s", it.Timestamp, it.Tuple, got)
+		}
+	}
+	if allowed, err := fga.Check(t.Context(), imported[0].Tuple); err != nil || !allowed {
+		t.Errorf("expected the imported tuple to be allowed, got %v, %+v", allowed, err)
+	}
+
+	if err := fga.ImportWithTimestamps(t.Context(), []TimedTuple{
+		{Tuple: Tuple{Object: "document:3", Relation: "viewer", User: "user:test@example.com"}},
+	}); err == nil {
+		t.Error("expected an error for a zero timestamp")
+	}
+
+	changes, _, err := fga.ReadChanges(t.Context(), "document", "")
+	if err != nil {
+		t.Fatalf("failed to read changes: %+v", err)
+	}
+	imports := 0
+	for _, c := range changes {
+		if c.Object == "document:2" && !c.Deleted {
+			imports++
+		}
+	}
+	if imports != len(imported) {
+		t.Errorf("expected the %d imported tuples in the changelog, got %+v", len(imported), changes)
+	}
+}
+
+func TestImportWithTimestampsAtomic(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	granted := time.Date(2019, 3, 14, 15, 9, 26, 0, time.UTC)
+	fresh := Tuple{Object: "document:2", Relation: "viewer", User: "user:test@example.com"}
+	for name, other := range map[string]Tuple{
+		"existing tuple":    fga.InitialTuples[0],
+		"invalid for model": {Object: "document:2", Relation: "owner", User: "user:test@example.com"},
+	} {
+		err := fga.ImportWithTimestamps(t.Context(), []TimedTuple{{Tuple: fresh, Timestamp: granted}, {Tuple: other, Timestamp: granted}})
+		if err == nil {
+			t.Errorf("%s: expected the import to fail", name)
+		}
+		if allowed, err := fga.Check(t.Context(), fresh); err != nil || allowed {
+			t.Errorf("%s: expected no tuple of the failed import to be written, got %v, %+v", name, allowed, err)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
@@ -76,15 +77,21 @@ func main() {
 		WithInitialTuples(tuples),
 		WithModelFile(os.Getenv("MODEL_FILE")),
 		WithStoreName(os.Getenv("STORE_NAME")),
+		WithStoreNamePrefix(os.Getenv("STORE_NAME_PREFIX")),
 		WithAuthorizationModelName(os.Getenv("AUTHORIZATION_MODEL_NAME")),
 		WithCacheTTLString(os.Getenv("CACHE_TTL")),
+		WithDebugDecisions(os.Getenv("DEBUG_DECISIONS") == "true"),
+		WithAssertionsCheck(os.Getenv("ASSERTIONS_CHECK") == "true"),
+		WithWarmup(os.Getenv("WARMUP") == "true"),
 	)
 	if err != nil {
 		fmt.Printf("Failed to initialize OpenFGA server:%+v\n", err)
 		return
 	}
 	defer func() {
-		_ = openFgaServer.Close()
+		if err := openFgaServer.Close(); err != nil {
+			fmt.Println("Error closing OpenFGA server:", err)
+		}
 	}()
 
 	r := gin.Default()
@@ -135,54 +142,52 @@ func main() {
 		if err != nil {
 			fmt.Println("Error retrieving user cookie:", err)
 			c.Redirect(http.StatusTemporaryRedirect, "/")
+			return
 		}
 		if userEmail == "" {
 			fmt.Println("User cookie is empty, redirecting to home")
 			c.Redirect(http.StatusTemporaryRedirect, "/")
-		}
-		c.HTML(http.StatusOK, "documents.tmpl", gin.H{
-			"title": "Documents",
-			"documents": map[string]map[string]string{
-				"1": {"id": "1", "name": "Document 1"},
-				"2": {"id": "2", "name": "Document 2"},
-			},
-		})
-	})
-
-	r.GET("/document/:docID/view", func(c *gin.Context) {
-		docID := c.Param("docID")
-		userEmail, err := c.Cookie("user")
-		if err != nil {
-			c.HTML(http.StatusUnauthorized, "auth-error.tmpl", gin.H{
-				"title":   "Authentication Error",
-				"message": "You must be logged in to view this document.",
-			})
 			return
 		}
-		// Policy Decision Point (PDP) check
-
-		allowed, err1 := openFgaServer.Check(c.Request.Context(), Tuple{Object: "document:" + docID, Relation: "viewer", User: "user:" + userEmail})
-
-		// Policy Enforcement Point (PEP) check
-		if err1 != nil {
-			fmt.Println("user:"+userEmail, "err:", err1)
-			c.HTML(http.StatusUnauthorized, "auth-error.tmpl", gin.H{
-				"title":   "Authentication Error",
-				"message": fmt.Sprintf("User %s is not allowed to view document %s", userEmail, docID),
-			})
-			return
+		documents := map[string]map[string]any{
+			"1": {"id": "1", "name": "Document 1"},
+			"2": {"id": "2", "name": "Document 2"},
 		}
-		if !allowed {
-			c.HTML(http.StatusUnauthorized, "auth-error.tmpl", gin.H{
-				"title":   "Authentication Error",
-				"message": fmt.Sprintf("User %s is not allowed to view document %s", userEmail, docID),
+		// the view access may depend on the request time, it is checked when a document is opened, only
+		// the edit links are hidden upfront
+		objects := make([]string, 0, len(documents))
+		for id := range documents {
+			objects = append(objects, "document:"+id)
+		}
+		editable, err := openFgaServer.CheckObjects(c.Request.Context(), objects, "editor", "user:"+userEmail)
+		if err != nil {
+			c.HTML(http.StatusInternalServerError, "error.tmpl", gin.H{
+				"title":   "Error",
+				"message": fmt.Sprintf("Failed to check the document permissions: %s", err),
 			})
 			return
 		}
+		for id, document := range documents {
+			document["editable"] = editable["document:"+id]
+		}
+		c.HTML(http.StatusOK, "documents.tmpl", gin.H{
+			"title":     "Documents",
+			"documents": documents,
+		})
+	})
+
+	// the view access may be granted during business hours only, the condition is evaluated at the request time
+	r.GET("/document/:docID/view", RequirePermission(openFgaServer, "viewer",
+		func(c *gin.Context) string { return "document:" + c.Param("docID") },
+		WithConditionContext(func(c *gin.Context) map[string]any {
+			return map[string]any{"current_time": time.Now().UTC().Format(time.RFC3339)}
+		}),
+		WithNotFoundForUnknownObjects(),
+	), func(c *gin.Context) {
 		c.HTML(http.StatusOK, "document.tmpl", gin.H{
 			"title":  "Document View",
-			"user":   userEmail,
-			"docID":  docID,
+			"user":   c.GetString(userContextKey),
+			"docID":  c.Param("docID"),
 			"action": "viewing",
 		})
 	})
@@ -316,6 +321,10 @@ func main() {
 		}
 		c.Redirect(http.StatusSeeOther, "/documents")
 	})
+	// the effective configuration, for the administrators only
+	r.GET("/admin/config", RequirePermission(openFgaServer, "admin",
+		func(c *gin.Context) string { return "app:auth" },
+	), openFgaServer.ConfigHandler)
 	err = r.Run(":8007")
 	if err != nil {
 		panic(err)
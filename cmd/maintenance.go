@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+	"github.com/pkg/errors"
+)
+
+// Backup writes an online snapshot of the sqlite datastore to destPath using VACUUM INTO, without stopping the
+// server. The snapshot is taken in a single read transaction, so it is consistent under concurrent writes,
+// which wait for it at most for the busy timeout. destPath must not exist.
+func (fga *OpenFGAServer) Backup(ctx context.Context, destPath string) error {
+	if destPath == "" {
+		return errors.New("backup destination cannot be empty")
+	}
+	if fga.db == nil {
+		return errors.New("backup requires the sqlite datastore, not an injected one")
+	}
+	if _, err := os.Stat(destPath); err == nil {
+		return errors.Errorf("backup destination %s already exists", destPath)
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to check backup destination")
+	}
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := fga.db.ExecContext(ctx, "VACUUM INTO ?", destPath); err != nil {
+		return errors.Wrapf(err, "failed to back up datastore to %s", destPath)
+	}
+	return nil
+}
+
+// Vacuum rebuilds the sqlite datastore file to reclaim the space left by deleted tuples, e.g. after a bulk
+// deletion, and truncates the write-ahead log. It locks the database for its duration, which grows with the size
+// of the datastore: it takes the write lock of the server, so the writes of the server wait for it, while the
+// writes of other processes wait at most for the busy timeout and then fail, so run it in a quiet period. The
+// changelog keeps the deleted tuples, their space is not reclaimed.
+func (fga *OpenFGAServer) Vacuum(ctx context.Context) error {
+	if fga.db == nil {
+		return errors.New("vacuum requires the sqlite datastore, not an injected one")
+	}
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := fga.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return errors.Wrap(err, "failed to vacuum datastore")
+	}
+	if _, err := fga.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return errors.Wrap(err, "failed to checkpoint datastore")
+	}
+	return nil
+}
+
+// FindOrphanedTuples reads all the tuples of the store and returns the ones referencing what the active model no
+// longer defines: the type or the relation of the object, the type of the user or the relation of a userset
+// user, or the condition. Such tuples are dead after a model change removed a relation, e.g. delete them with
+// Delete to clean up after a model migration.
+func (fga *OpenFGAServer) FindOrphanedTuples(ctx context.Context) ([]*openfgav1.Tuple, error) {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r, err := fga.Server.ReadAuthorizationModel(ctx, &openfgav1.ReadAuthorizationModelRequest{
+		StoreId: fga.StoreID,
+		Id:      fga.ActiveModelID(),
+	})
+	release()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the active authorization model")
+	}
+	ts, err := typesystem.New(r.GetAuthorizationModel())
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid authorization model")
+	}
+	// defined tells whether the relation of the type is defined, or the type itself for an empty relation
+	defined := func(objectType, relation string) bool {
+		relations, err := ts.GetRelations(objectType)
+		if err != nil {
+			return false
+		}
+		_, ok := relations[relation]
+		return relation == "" || ok
+	}
+	tuples, err := fga.readStoredTuples(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	var orphaned []*openfgav1.Tuple
+	for _, t := range tuples {
+		key := t.GetKey()
+		userObject, userRelation := tuple.SplitObjectRelation(key.GetUser())
+		_, conditionDefined := ts.GetConditions()[key.GetCondition().GetName()]
+		if !defined(tuple.GetType(key.GetObject()), key.GetRelation()) ||
+			!defined(tuple.GetType(userObject), userRelation) ||
+			(key.GetCondition() != nil && !conditionDefined) {
+			orphaned = append(orphaned, t)
+		}
+	}
+	return orphaned, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+func TestBackup(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+
+	// keep writing while the backup runs
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 20 {
+			_ = fga.Write(t.Context(), []Tuple{{Object: "document:2", Relation: "viewer", User: fmt.Sprintf("user:%d@example.com", i)}}, false)
+		}
+	}()
+	destPath := filepath.Join(t.TempDir(), "backup.db")
+	err := fga.Backup(t.Context(), destPath)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("failed to back up datastore: %+v", err)
+	}
+	if err := fga.Backup(t.Context(), destPath); err == nil {
+		t.Error("expected an error backing up to an existing file")
+	}
+
+	restored, err := NewOpenFGA(destPath,
+		WithInitialTuples(fga.InitialTuples),
+		WithModelFile(fga.ModelFile),
+		WithStoreName(fga.StoreName),
+		WithAuthorizationModelName(fga.AuthorizationModelName),
+	)
+	if err != nil {
+		t.Fatalf("failed to open the backup: %+v", err)
+	}
+	defer restored.Close()
+	if restored.StoreID != fga.StoreID {
+		t.Errorf("backup store ID = %s, want %s", restored.StoreID, fga.StoreID)
+	}
+	if allowed, err := restored.Check(t.Context(), fga.InitialTuples[0]); err != nil || !allowed {
+		t.Errorf("expected the backed up tuple to be allowed, got %v, %+v", allowed, err)
+	}
+}
+
+func TestVacuum(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	var tuples []Tuple
+	for i := range 2000 {
+		tuples = append(tuples, Tuple{Object: "document:2", Relation: "viewer", User: fmt.Sprintf("user:%d-%s@example.com", i, strings.Repeat("x", 100))})
+	}
+	if err := fga.Write(t.Context(), tuples, false); err != nil {
+		t.Fatalf("failed to write tuples: %+v", err)
+	}
+	if _, err := fga.DeleteObjectTuples(t.Context(), "document:2"); err != nil {
+		t.Fatalf("failed to delete tuples: %+v", err)
+	}
+	if err := fga.Vacuum(t.Context()); err != nil {
+		t.Fatalf("failed to vacuum datastore: %+v", err)
+	}
+	var freePages int
+	if err := fga.db.QueryRowContext(t.Context(), "PRAGMA freelist_count").Scan(&freePages); err != nil {
+		t.Fatal(err)
+	}
+	if freePages != 0 {
+		t.Errorf("expected no free pages after the vacuum, got %d", freePages)
+	}
+	if allowed, err := fga.Check(t.Context(), fga.InitialTuples[0]); err != nil || !allowed {
+		t.Errorf("expected the remaining tuple to be allowed, got %v, %+v", allowed, err)
+	}
+
+	// a pending write of the server holds the write lock, the vacuum waits for it
+	unlock, err := fga.lockWrites(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+	if err := fga.Vacuum(ctx); err == nil {
+		t.Error("expected the vacuum to wait for the write lock")
+	}
+	unlock()
+}
+
+func TestFindOrphanedTuples(t *testing.T) {
+	fga := newTestOpenFGA(t, `model
+  schema 1.1
+
+type user
+type group
+   relations
+		define member: [user]
+type document
+   relations
+		define viewer: [user, group#member] or editor
+		define editor: [user]
+`, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:alice"},
+		{Object: "document:1", Relation: "viewer", User: "user:bob"},
+		{Object: "document:1", Relation: "viewer", User: "group:eng#member"},
+		{Object: "group:eng", Relation: "member", User: "user:carol"},
+	})
+	if orphaned, err := fga.FindOrphanedTuples(t.Context()); err != nil || len(orphaned) != 0 {
+		t.Fatalf("expected no orphaned tuples, got %v, %+v", orphaned, err)
+	}
+
+	// the new model drops the editor relation and the group type
+	model, err := parser.TransformDSLToProto(`model
+  schema 1.1
+
+type user
+type document
+   relations
+		define viewer: [user]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fga.Server.WriteAuthorizationModel(t.Context(), &openfgav1.WriteAuthorizationModelRequest{
+		StoreId:         fga.StoreID,
+		SchemaVersion:   model.GetSchemaVersion(),
+		TypeDefinitions: model.GetTypeDefinitions(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fga.Refresh(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	orphaned, err := fga.FindOrphanedTuples(t.Context())
+	if err != nil {
+		t.Fatalf("failed to find orphaned tuples: %+v", err)
+	}
+	var got []string
+	for _, o := range orphaned {
+		got = append(got, tuple.TupleKeyToString(o.GetKey()))
+	}
+	slices.Sort(got)
+	want := []string{"document:1#editor@user:alice", "document:1#viewer@group:eng#member", "group:eng#member@user:carol"}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindOrphanedTuples() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userContextKey is the gin context key of the email of the user authorized by RequirePermission.
+const userContextKey = "user"
+
+// checkMemoContextKey is the gin context key of the Check decisions memoized by CheckMemoized.
+const checkMemoContextKey = "openfga.checkMemo"
+
+// checkMemo holds the Check decisions of a single request.
+type checkMemo struct {
+	mu        sync.Mutex
+	decisions map[TupleID]bool
+}
+
+// CheckMemoized checks the tuple once per request: the decision is kept in the gin context, so the same Check
+// repeated by the middlewares and the handler of the request is only sent to the server the first time.
+// Errors are not memoized.
+func CheckMemoized(c *gin.Context, fga *OpenFGAServer, t Tuple) (bool, error) {
+	value, _ := c.Get(checkMemoContextKey)
+	memo, ok := value.(*checkMemo)
+	if !ok {
+		memo = &checkMemo{decisions: make(map[TupleID]bool)}
+		c.Set(checkMemoContextKey, memo)
+	}
+	memo.mu.Lock()
+	allowed, ok := memo.decisions[t.ID()]
+	memo.mu.Unlock()
+	if ok {
+		return allowed, nil
+	}
+	allowed, err := fga.Check(c.Request.Context(), t)
+	if err != nil {
+		return false, err
+	}
+	memo.mu.Lock()
+	memo.decisions[t.ID()] = allowed
+	memo.mu.Unlock()
+	return allowed, nil
+}
+
+// PermissionOption configures RequirePermission.
+type PermissionOption func(*permissionConfig)
+
+type permissionConfig struct {
+	conditionContext func(c *gin.Context) map[string]any
+	notFound         bool
+}
+
+// WithConditionContext computes the condition context of the Check from the request, e.g. the current time for
+// a time window condition or the attributes returned by ContextFromRequest.
+func WithConditionContext(conditionContext func(c *gin.Context) map[string]any) PermissionOption {
+	return func(cfg *permissionConfig) {
+		cfg.conditionContext = conditionContext
+	}
+}
+
+// WithNotFoundForUnknownObjects answers a denied request with 404 and the error page when no tuple names the
+// object (see ObjectExists), instead of the auth-error page, e.g. for the views of deleted documents.
+func WithNotFoundForUnknownObjects() PermissionOption {
+	return func(cfg *permissionConfig) {
+		cfg.notFound = true
+	}
+}
+
+// RequirePermission is a Policy Enforcement Point (PEP) middleware: it lets the request through only when the
+// logged-in user (the "user" cookie) has the relation with the object returned by object, e.g.
+// "document:" + c.Param("docID"). The email of the authorized user is available to the handler with
+// c.GetString("user"), a denied request is answered with the auth-error page.
+func RequirePermission(fga *OpenFGAServer, relation string, object func(c *gin.Context) string, opts ...PermissionOption) gin.HandlerFunc {
+	cfg := permissionConfig{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(c *gin.Context) {
+		userEmail, err := c.Cookie("user")
+		if err != nil || userEmail == "" {
+			c.HTML(http.StatusUnauthorized, "auth-error.tmpl", gin.H{
+				"title":   "Authentication Error",
+				"message": "You must be logged in to access this page.",
+			})
+			c.Abort()
+			return
+		}
+		// Policy Decision Point (PDP) check
+		t := Tuple{Object: object(c), Relation: relation, User: "user:" + userEmail}
+		var allowed bool
+		if cfg.conditionContext != nil {
+			allowed, err = fga.CheckWithCondition(c.Request.Context(), t, cfg.conditionContext(c))
+		} else {
+			allowed, err = CheckMemoized(c, fga, t)
+		}
+		if err != nil {
+			slog.Warn("Permission check failed", slog.String("tuple", t.String()), slog.Any("err", err))
+		}
+		if err == nil && !allowed && cfg.notFound {
+			var exists bool
+			exists, err = fga.ObjectExists(c.Request.Context(), t.Object)
+			if err != nil {
+				slog.Warn("Object lookup failed", slog.String("object", t.Object), slog.Any("err", err))
+			} else if !exists {
+				c.HTML(http.StatusNotFound, "error.tmpl", gin.H{
+					"title":   "Not Found",
+					"message": fmt.Sprintf("%s does not exist", t.Object),
+				})
+				c.Abort()
+				return
+			}
+		}
+		if err != nil || !allowed {
+			c.HTML(http.StatusUnauthorized, "auth-error.tmpl", gin.H{
+				"title":   "Authentication Error",
+				"message": fmt.Sprintf("User %s is not allowed to access %s as %s", userEmail, t.Object, relation),
+			})
+			c.Abort()
+			return
+		}
+		c.Set(userContextKey, userEmail)
+		c.Next()
+	}
+}
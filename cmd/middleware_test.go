@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const conditionModel = `model
+  schema 1.1
+
+type user
+type document
+   relations
+		define viewer: [user, user with business_hours]
+
+condition business_hours(current_time: timestamp) {
+  current_time.getHours() >= 9 && current_time.getHours() < 17
+}
+`
+
+func TestRequirePermission(t *testing.T) {
+	fga := newTestOpenFGA(t, conditionModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:anytime@example.com"},
+		{Object: "document:1", Relation: "viewer", User: "user:daytime@example.com", Condition: "business_hours"},
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.LoadHTMLGlob("../templates/*")
+	currentTime := ""
+	r.GET("/document/:docID/view", RequirePermission(fga, "viewer",
+		func(c *gin.Context) string { return "document:" + c.Param("docID") },
+		WithConditionContext(func(c *gin.Context) map[string]any {
+			return map[string]any{"current_time": currentTime}
+		}),
+	), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(userContextKey))
+	})
+
+	for _, tc := range []struct {
+		user        string
+		currentTime string
+		want        int
+	}{
+		{user: "anytime@example.com", currentTime: "2024-01-01T20:00:00Z", want: http.StatusOK},
+		{user: "daytime@example.com", currentTime: "2024-01-01T10:00:00Z", want: http.StatusOK},
+		{user: "daytime@example.com", currentTime: "2024-01-01T20:00:00Z", want: http.StatusUnauthorized},
+		{user: "nobody@example.com", currentTime: "2024-01-01T10:00:00Z", want: http.StatusUnauthorized},
+		{user: "", currentTime: "2024-01-01T10:00:00Z", want: http.StatusUnauthorized},
+	} {
+		currentTime = tc.currentTime
+		req := httptest.NewRequest("GET", "/document/1/view", nil)
+		if tc.user != "" {
+			req.AddCookie(&http.Cookie{Name: "user", Value: tc.user})
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("user %q at %s: got status %d, want %d", tc.user, tc.currentTime, w.Code, tc.want)
+		}
+		if tc.want == http.StatusOK && w.Body.String() != tc.user {
+			t.Errorf("expected the handler to see user %q, got %q", tc.user, w.Body.String())
+		}
+	}
+}
+
+func TestRequirePermissionNotFound(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:test@example.com"},
+	})
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.LoadHTMLGlob("../templates/*")
+	r.GET("/document/:docID/view", RequirePermission(fga, "viewer",
+		func(c *gin.Context) string { return "document:" + c.Param("docID") },
+		WithNotFoundForUnknownObjects(),
+	), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(userContextKey))
+	})
+
+	for _, tc := range []struct {
+		user, docID string
+		want        int
+	}{
+		{user: "test@example.com", docID: "1", want: http.StatusOK},
+		{user: "another@example.com", docID: "1", want: http.StatusUnauthorized},
+		{user: "another@example.com", docID: "2", want: http.StatusNotFound},
+	} {
+		req := httptest.NewRequest("GET", "/document/"+tc.docID+"/view", nil)
+		req.AddCookie(&http.Cookie{Name: "user", Value: tc.user})
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("user %q on document %s: got status %d, want %d", tc.user, tc.docID, w.Code, tc.want)
+		}
+	}
+}
+
+func TestCheckMemoized(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	editor := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/document/1/edit", nil)
+	for range 3 {
+		if allowed, err := CheckMemoized(c, fga, editor); err != nil || !allowed {
+			t.Fatalf("expected the editor check to be allowed, got %v, %+v", allowed, err)
+		}
+	}
+	if got := fga.Stats().Checks; got != 1 {
+		t.Errorf("expected a single Check within the request, got %d", got)
+	}
+
+	// a new request starts with an empty memo
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/document/1/edit", nil)
+	if _, err := CheckMemoized(c, fga, editor); err != nil {
+		t.Fatalf("failed to check tuple: %+v", err)
+	}
+	if got := fga.Stats().Checks; got != 2 {
+		t.Errorf("expected a new Check for the next request, got %d", got)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// modelCacheMaxEntries bounds the number of cached models, the least recently used one is evicted first, e.g.
+// the old versions of a hot-reloaded model.
+const modelCacheMaxEntries = 64
+
+// modelCacheEntry is a cached model with its key, to remove it from the index on eviction.
+type modelCacheEntry struct {
+	key   [sha256.Size]byte
+	model *openfgav1.AuthorizationModel
+}
+
+// modelCache holds the authorization models transformed from their DSL, keyed by the SHA-256 of the DSL, so the
+// servers of a process loading the same model, e.g. one per tenant, parse and transform it only once.
+var modelCache struct {
+	mu         sync.Mutex
+	entries    map[[sha256.Size]byte]*list.Element // entries index the elements of lru
+	lru        list.List                           // lru holds the modelCacheEntry values, most recently used first
+	maxEntries int                                 // maxEntries overrides modelCacheMaxEntries in the tests
+}
+
+// cachedModel returns a copy of the model cached for the DSL parts, transforming it on a miss. A failed
+// transformation is not cached. The returned model can be modified, the cached one is never handed out.
+func cachedModel(transform func() (*openfgav1.AuthorizationModel, error), dsl ...string) (*openfgav1.AuthorizationModel, error) {
+	h := sha256.New()
+	for _, part := range dsl {
+		// the length prefix keeps the boundaries of the parts, ("ab", "c") and ("a", "bc") differ
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(part))))
+		h.Write([]byte(part))
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	if m := loadCachedModel(key); m != nil {
+		return proto.Clone(m).(*openfgav1.AuthorizationModel), nil
+	}
+	model, err := transform()
+	if err != nil {
+		return nil, err
+	}
+	storeCachedModel(key, proto.Clone(model).(*openfgav1.AuthorizationModel))
+	return model, nil
+}
+
+func loadCachedModel(key [sha256.Size]byte) *openfgav1.AuthorizationModel {
+	modelCache.mu.Lock()
+	defer modelCache.mu.Unlock()
+	e, ok := modelCache.entries[key]
+	if !ok {
+		return nil
+	}
+	modelCache.lru.MoveToFront(e)
+	return e.Value.(modelCacheEntry).model
+}
+
+func storeCachedModel(key [sha256.Size]byte, model *openfgav1.AuthorizationModel) {
+	modelCache.mu.Lock()
+	defer modelCache.mu.Unlock()
+	if modelCache.entries == nil {
+		modelCache.entries = make(map[[sha256.Size]byte]*list.Element)
+	}
+	if e, ok := modelCache.entries[key]; ok {
+		// transformed concurrently by another caller
+		modelCache.lru.MoveToFront(e)
+		return
+	}
+	modelCache.entries[key] = modelCache.lru.PushFront(modelCacheEntry{key: key, model: model})
+	maxEntries := modelCache.maxEntries
+	if maxEntries == 0 {
+		maxEntries = modelCacheMaxEntries
+	}
+	for modelCache.lru.Len() > maxEntries {
+		delete(modelCache.entries, modelCache.lru.Remove(modelCache.lru.Back()).(modelCacheEntry).key)
+	}
+}
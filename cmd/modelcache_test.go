@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+)
+
+func TestCachedModel(t *testing.T) {
+	transforms := 0
+	transform := func() (*openfgav1.AuthorizationModel, error) {
+		transforms++
+		return parser.TransformDSLToProto(wildcardModel)
+	}
+	m1, err := cachedModel(transform, "test-cached-model", wildcardModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1.TypeDefinitions = nil // the callers may modify the returned model
+	m2, err := cachedModel(transform, "test-cached-model", wildcardModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transforms != 1 {
+		t.Errorf("expected the model to be transformed once, got %d", transforms)
+	}
+	if len(m2.GetTypeDefinitions()) != 2 {
+		t.Errorf("expected the cached model to be unaffected by the modification, got %v", m2.GetTypeDefinitions())
+	}
+	if _, err := cachedModel(transform, "test-cached-model"+wildcardModel); err != nil || transforms != 2 {
+		t.Errorf("expected the joined parts to be a different key, got %d transforms, %+v", transforms, err)
+	}
+}
+
+func TestCachedModelBound(t *testing.T) {
+	modelCache.mu.Lock()
+	modelCache.maxEntries = 2
+	modelCache.mu.Unlock()
+	t.Cleanup(func() {
+		modelCache.mu.Lock()
+		modelCache.maxEntries = 0
+		modelCache.mu.Unlock()
+	})
+	transforms := 0
+	transform := func() (*openfgav1.AuthorizationModel, error) {
+		transforms++
+		return parser.TransformDSLToProto(wildcardModel)
+	}
+	for _, part := range []string{"test-bound-1", "test-bound-2", "test-bound-1", "test-bound-3", "test-bound-1", "test-bound-2"} {
+		if _, err := cachedModel(transform, part, wildcardModel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// test-bound-1 stays the most recently used, test-bound-2 is evicted by test-bound-3
+	if transforms != 4 {
+		t.Errorf("expected 4 transformations with a bound of 2 models, got %d", transforms)
+	}
+}
+
+// BenchmarkReadModelFile compares loading the same model for many servers with and without the model cache.
+func BenchmarkReadModelFile(b *testing.B) {
+	modelFile := filepath.Join(b.TempDir(), "model.fga")
+	data, err := os.ReadFile("../model.fga")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.WriteFile(modelFile, data, 0o600); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := readModelFile(modelFile); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		for b.Loop() {
+			data, err := os.ReadFile(modelFile)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := parser.TransformDSLToProto(string(data)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
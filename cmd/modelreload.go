@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	"github.com/fsnotify/fsnotify"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/pkg/errors"
+)
+
+// modelReloadDebounce groups the burst of events an editor emits when saving the model file.
+const modelReloadDebounce = 100 * time.Millisecond
+
+// ActiveModelID returns the ID of the authorization model used by Check, Write and the other operations.
+// It changes when the model file is hot-reloaded.
+func (fga *OpenFGAServer) ActiveModelID() string {
+	fga.modelMu.RLock()
+	defer fga.modelMu.RUnlock()
+	return fga.authorizationModelID
+}
+
+// SchemaVersion returns the schema version of the active authorization model, e.g. "1.1". Tooling can use it
+// to decide which model features (conditions, etc.) are available.
+func (fga *OpenFGAServer) SchemaVersion() string {
+	fga.modelMu.RLock()
+	defer fga.modelMu.RUnlock()
+	return fga.schemaVersion
+}
+
+func (fga *OpenFGAServer) setActiveModel(modelID, schemaVersion string) {
+	fga.modelMu.Lock()
+	defer fga.modelMu.Unlock()
+	fga.authorizationModelID = modelID
+	fga.schemaVersion = schemaVersion
+}
+
+// newModelWatcher watches the directory of the model file, editors often replace the file instead of writing it.
+func newModelWatcher(path string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create model file watcher")
+	}
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, errors.Wrapf(err, "failed to watch model file %s", path)
+	}
+	return watcher, nil
+}
+
+// watchModelFile reloads the model whenever the model file changes, until ctx is cancelled.
+func (fga *OpenFGAServer) watchModelFile(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	name := filepath.Clean(fga.ModelHotReloadFile)
+	debounce := time.NewTimer(modelReloadDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == name && event.Has(fsnotify.Write|fsnotify.Create) {
+				debounce.Reset(modelReloadDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Model file watcher error", slog.Any("err", err))
+		case <-debounce.C:
+			if err := fga.reloadModel(ctx); err != nil {
+				slog.Error("Failed to reload the authorization model, keeping the active one",
+					slog.String("model_id", fga.ActiveModelID()), slog.Any("err", err))
+			}
+		}
+	}
+}
+
+// reloadModel validates the model file and writes it as a new model version that becomes the active model.
+func (fga *OpenFGAServer) reloadModel(ctx context.Context) error {
+	model, err := readModelFile(fga.ModelHotReloadFile)
+	if err != nil {
+		return err
+	}
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	modelID, err := fga.writeModel(ctx, model)
+	unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to write authorization model")
+	}
+	fga.setActiveModel(modelID, model.GetSchemaVersion())
+	slog.Info("Authorization model reloaded", slog.String("model_id", modelID))
+	return nil
+}
+
+// writeModel writes the model to the store, with an ID generated by IDGenerator if set, and returns its ID.
+func (fga *OpenFGAServer) writeModel(ctx context.Context, model *openfgav1.AuthorizationModel) (string, error) {
+	return embeddfga.WriteModel(ctx, fga.Server, fga.StoreID, embeddfga.BootstrapConfig{
+		Datastore: fga.datastore,
+		Model:     model,
+		NewID:     fga.IDGenerator,
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/pkg/errors"
+)
+
+// modFileName is the manifest of a modular model, listing its module files and its schema version.
+const modFileName = "fga.mod"
+
+// modularSchemaVersion is the schema version of a modular model without a manifest, modules require 1.2.
+const modularSchemaVersion = "1.2"
+
+// WithModelDir loads a modular model from the directory instead of a single ModelFile, e.g. when a large model is
+// split into `module` files per team. The modules are listed by the fga.mod manifest of the directory if it has
+// one, otherwise all the .fga files of the directory are combined with schema 1.2. The assertions file of the
+// model is looked up next to the directory (see AssertionsFile).
+func WithModelDir(dir string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if dir == "" {
+			return errors.New("model directory cannot be empty")
+		}
+		fga.ModelDir = dir
+		return nil
+	}
+}
+
+// readModelDir reads the module files of the directory and combines them into one authorization model.
+func readModelDir(dir string) (*openfgav1.AuthorizationModel, error) {
+	schemaVersion := modularSchemaVersion
+	var files []string
+	manifest, err := os.ReadFile(filepath.Join(dir, modFileName))
+	switch {
+	case err == nil:
+		mod, err := parser.TransformModFile(string(manifest))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", modFileName)
+		}
+		schemaVersion = mod.Schema.Value
+		for _, c := range mod.Contents.Value {
+			files = append(files, c.Value)
+		}
+	case os.IsNotExist(err):
+		files, err = filepath.Glob(filepath.Join(dir, "*.fga"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to list the model modules")
+		}
+		for i, f := range files {
+			files[i] = filepath.Base(f)
+		}
+		slices.Sort(files)
+	default:
+		return nil, errors.Wrapf(err, "failed to read %s", modFileName)
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("model directory has no modules: %s", dir)
+	}
+	modules := make([]parser.ModuleFile, 0, len(files))
+	dsl := []string{schemaVersion}
+	for _, f := range files {
+		contents, err := os.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read model module")
+		}
+		modules = append(modules, parser.ModuleFile{Name: f, Contents: string(contents)})
+		dsl = append(dsl, f, string(contents))
+	}
+	return cachedModel(func() (*openfgav1.AuthorizationModel, error) {
+		model, err := parser.TransformModuleFilesToModel(modules, schemaVersion)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to transform the modules to OpenFGA model")
+		}
+		return model, nil
+	}, dsl...)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const coreModule = `module core
+
+type user
+type document
+   relations
+		define editor: [user]
+`
+
+const sharingModule = `module sharing
+
+extend type document
+   relations
+		define viewer: [user] or editor
+`
+
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %+v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestWithModelDir(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"all .fga files": {"core.fga": coreModule, "sharing.fga": sharingModule, "README.md": "not a module"},
+		"fga.mod manifest": {
+			"fga.mod":     "schema: '1.2'\ncontents:\n  - core.fga\n  - sharing/sharing.fga\n",
+			"core.fga":    coreModule,
+			"ignored.fga": "not a module",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := writeModules(t, files)
+			if _, ok := files["fga.mod"]; ok {
+				if err := os.Mkdir(filepath.Join(dir, "sharing"), 0o700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "sharing", "sharing.fga"), []byte(sharingModule), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+			fga, err := NewOpenFGA(filepath.Join(t.TempDir(), "openfga.db"),
+				WithInitialTuples([]Tuple{tpl}),
+				WithModelDir(dir),
+				WithStoreName("test_store"),
+				WithAuthorizationModelName("default"),
+			)
+			if err != nil {
+				t.Fatalf("failed to create OpenFGA server: %+v", err)
+			}
+			defer fga.Close()
+			if got := fga.SchemaVersion(); got != "1.2" {
+				t.Errorf("expected the schema version 1.2, got %q", got)
+			}
+			allowed, err := fga.Check(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"})
+			if err != nil || !allowed {
+				t.Errorf("expected the extended viewer relation to be granted, got %v, %+v", allowed, err)
+			}
+		})
+	}
+}
+
+func TestReadModelDirErrors(t *testing.T) {
+	if _, err := readModelDir(writeModules(t, map[string]string{"README.md": "no modules"})); err == nil {
+		t.Error("expected an error for a directory without modules")
+	}
+	if _, err := readModelDir(writeModules(t, map[string]string{"core.fga": coreModule, "other.fga": coreModule})); err == nil {
+		t.Error("expected an error for a type defined by two modules")
+	}
+}
@@ -3,12 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 )
 
+// mockOAuthServer starts a mock of the GitHub OAuth endpoints on an ephemeral port of the loopback interface, its
+// URL holds the chosen address. Several mock servers can run at once, e.g. in parallel tests.
 func mockOAuthServer() *httptest.Server {
 	mux := http.NewServeMux()
 
@@ -93,9 +94,5 @@ func mockOAuthServer() *httptest.Server {
 		}
 	})
 
-	server := httptest.NewUnstartedServer(mux)
-	listener, _ := net.Listen("tcp", "localhost:9001")
-	server.Listener = listener
-	server.Start()
-	return server
+	return httptest.NewServer(mux)
 }
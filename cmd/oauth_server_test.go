@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestMockOAuthServer(t *testing.T) {
+	first := mockOAuthServer()
+	defer first.Close()
+	second := mockOAuthServer()
+	defer second.Close()
+	if first.URL == second.URL {
+		t.Fatalf("expected the mock servers to listen on different addresses, both got %s", first.URL)
+	}
+	r, err := http.PostForm(second.URL+"/token", url.Values{"code": {"mock-code:test@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		t.Errorf("expected the token endpoint to answer 200, got %d", r.StatusCode)
+	}
+}
@@ -2,21 +2,30 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	stderrors "errors"
 	"log/slog"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/openfga/openfga/pkg/logger"
 	"github.com/openfga/openfga/pkg/server"
+	"github.com/openfga/openfga/pkg/storage"
 	"github.com/openfga/openfga/pkg/storage/migrate"
 	"github.com/openfga/openfga/pkg/storage/sqlcommon"
 	"github.com/openfga/openfga/pkg/storage/sqlite"
 	"github.com/openfga/openfga/pkg/tuple"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func Migrate(ctx context.Context, datastoreURI string) error {
@@ -28,27 +37,104 @@ func Migrate(ctx context.Context, datastoreURI string) error {
 		Engine:        "sqlite",
 		URI:           datastoreURI,
 		Verbose:       true,
-		TargetVersion: 6,
+		TargetVersion: embeddfga.SqliteSchemaVersion,
 	})
 }
 
-type Tuple struct {
-	Object   string `json:"object"`
-	Relation string `json:"relation"`
-	User     string `json:"user"`
+// readPageSize is the page size used when paging through Read, it is the maximum allowed by OpenFGA.
+const readPageSize = 100
+
+// writeBatchSize is the maximum number of tuple operations OpenFGA accepts in a single WriteRequest.
+const writeBatchSize = 100
+
+// startupTimeout bounds the whole wait of NewOpenFGA for the datastore and the OpenFGA server to be ready, retries
+// included.
+const startupTimeout = 30 * time.Second
+
+// maxDatastoreRetryBackoff caps the doubling wait between two datastore connection retries at startup.
+const maxDatastoreRetryBackoff = 10 * time.Second
+
+// Tuple is the relationship tuple shared with the fgaclient package.
+type Tuple = embeddfga.Tuple
+
+// LifecycleEvent reports a completed bootstrap step to the hook of WithLifecycleHook.
+type LifecycleEvent = embeddfga.LifecycleEvent
+
+// TupleID identifies a tuple regardless of its condition.
+type TupleID = embeddfga.TupleID
+
+// PublicUser returns the OpenFGA wildcard user for the given type, e.g. "user:*" for userType "user".
+// A tuple written with this user grants the relation to every user of that type. OpenFGA only accepts
+// it when the model lists the wildcard as a directly related type (e.g. `define viewer: [user, user:*]`),
+// otherwise its validator rejects the write. The local validator only checks that the user is non-empty.
+func PublicUser(userType string) string {
+	return userType + ":*"
+}
+
+// Userset returns the OpenFGA userset of the users having the relation with the object, e.g. "group:eng#member"
+// for Userset("group", "eng", "member"). A tuple written with this user grants the relation to every member of
+// the userset, the model must list it as a directly related type (e.g. `define viewer: [user, group#member]`).
+func Userset(objectType, id, relation string) string {
+	return tuple.ToObjectRelationString(tuple.BuildObject(objectType, id), relation)
 }
 
 type OpenFGAServer struct {
-	Server                 *server.Server // reference to the OpenFGA server instance
-	StoreName              string         `validate:"required"` // Human-readable name of the store, used for identification. OpenFGA works with storeIDs but we use the name to look it up at startupl;
-	StoreID                string         // StoreID is the unique identifier for the store in OpenFGA, it is used to reference the store in API calls
-	AuthorizationModelID   string         // AuthorizationModelID is the unique identifier for the authorization model in OpenFGA, it is used to reference the model in API calls
-	AuthorizationModelName string         `validate:"required"`            // AuthorizationModelName is the human-readable name of the authorization model, used for identification
-	InitialTuples          []Tuple        `validate:"min=1,dive,required"` // InitialTuples is a list of tuples to be written to OpenFGA at startup, this is used to initialize the store with some data
-	ModelFile              string         `validate:"required,file"`       // ModelFile is the path to the OpenFGA model file, it is used to define the authorization model in OpenFGA
-	dataStoreURI           string         `validate:"required,url"`        // dataStoreURI is the URI of the datastore, it is used to connect to the database
-	MaxEvaluationCost      int            `validate:"gte=0"`               // This is a global setting, use wisely
-	CacheTTL               time.Duration  `validate:"required"`            // CacheTTL is the time-to-live for the cache, used to control how long cached data is valid (default is 10 minutes)
+	Server                 *server.Server           // reference to the OpenFGA server instance
+	StoreName              string                   `validate:"required"` // Human-readable name of the store, used for identification. OpenFGA works with storeIDs but we use the name to look it up at startupl;
+	StoreID                string                   // StoreID is the unique identifier for the store in OpenFGA, it is used to reference the store in API calls
+	AuthorizationModelName string                   `validate:"required"`                                 // AuthorizationModelName is the human-readable name of the authorization model, used for identification
+	InitialTuples          []Tuple                  `validate:"min=1,dive,required"`                      // InitialTuples is a list of tuples to be written to OpenFGA at startup, this is used to initialize the store with some data
+	ModelFile              string                   `validate:"required_without=ModelDir,omitempty,file"` // ModelFile is the path to the OpenFGA model file, it is used to define the authorization model in OpenFGA
+	ModelDir               string                   `validate:"omitempty,dir"`                            // ModelDir is the directory of a modular model, used instead of ModelFile
+	dataStoreURI           string                   `validate:"omitempty,url"`                            // dataStoreURI is the URI of the datastore, it is used to connect to the database
+	MaxEvaluationCost      int                      `validate:"gte=0"`                                    // This is a global setting, use wisely
+	CacheTTL               time.Duration            `validate:"gte=0"`                                    // CacheTTL is the time-to-live for the cache, used to control how long cached data is valid (default is 10 minutes), 0 disables the caches
+	ModelHotReloadFile     string                   // ModelHotReloadFile is a model file watched for changes, each change is written as a new active model version
+	ReadReplicaURI         string                   // ReadReplicaURI is the URI of an optional read-only datastore replica serving Check and ListObjects
+	CacheWarming           bool                     // CacheWarming pre-issues Checks in the background after startup to warm the check query cache
+	CacheWarmingTuples     []Tuple                  // CacheWarmingTuples are the frequently-accessed tuples checked by the cache warmer
+	Warmup                 bool                     // Warmup issues a throwaway Check during the construction, so the first request does not pay the first Check cost
+	ExpirySweepInterval    time.Duration            // ExpirySweepInterval is the period of the expired temporary grants sweeper, 0 disables it
+	AssertionsCheck        bool                     // AssertionsCheck runs the assertions from the model assertions file at startup and fails if any does not match
+	SelfTestExpectations   []Expectation            // SelfTestExpectations are checked by SelfTest after seeding, a mismatch fails the construction
+	UniqueStoreName        bool                     // UniqueStoreName makes the construction fail if more than one store exists with StoreName
+	StoreNamePrefix        string                   // StoreNamePrefix namespaces StoreName in the datastore, so several apps can share one datastore file
+	StoreTags              map[string]string        // StoreTags are the key/value metadata written for the store at startup, see StoreMetadata
+	TraceIDContextKey      any                      // TraceIDContextKey is the context key of the request trace ID attached to the OpenFGA logs, nil disables it
+	LogSampling            uint64                   // LogSampling logs 1 in LogSampling debug and info records of each message of the OpenFGA server, 0 or 1 logs all
+	DebugDecisions         bool                     // DebugDecisions enables a structured debug log for every Check decision (default is false)
+	PerTypeCacheTTL        map[string]time.Duration // PerTypeCacheTTL overrides CacheTTL for the Check decisions of the listed object types
+	ConnMaxIdleTime        time.Duration            // ConnMaxIdleTime is the idle time after which a sqlite connection is closed (default is 5 minutes)
+	AutoMigrate            bool                     // AutoMigrate runs the pending migrations of the sqlite datastore at startup (default is true)
+	CheckQueryCacheLimit   uint32                   // CheckQueryCacheLimit is the maximum number of entries of the check caches (default is 10000)
+	MaxConcurrentRequests  int64                    // MaxConcurrentRequests bounds the concurrent requests to the OpenFGA server and the datastore, 0 is unbounded
+	ListObjectsDeadline    time.Duration            // ListObjectsDeadline bounds the evaluation time of a ListObjects (default is 3 seconds), 0 is unbounded
+	ListObjectsMaxResults  uint32                   // ListObjectsMaxResults caps the objects returned by a ListObjects (default is 1000), 0 is unbounded
+	QueueRequests          bool                     // QueueRequests makes the requests beyond MaxConcurrentRequests wait instead of failing with ErrServerBusy (default is true)
+	Bootstrap              BootstrapFunc            // Bootstrap replaces the default store and model lookup, see WithBootstrap
+	Datastore              storage.OpenFGADatastore // Datastore is an injected datastore used instead of the sqlite datastore at dataStoreURI, e.g. a fake in tests
+	DatastoreRetryAttempts int                      `validate:"gte=0"` // DatastoreRetryAttempts is the number of retries of a failed datastore connection at startup (default is 5)
+	DatastoreRetryBackoff  time.Duration            // DatastoreRetryBackoff is the wait before the first retry, doubled at every retry (default is 100ms)
+	LifecycleHook          func(LifecycleEvent)     // LifecycleHook receives the bootstrap events, see WithLifecycleHook
+	IDGenerator            func() string            // IDGenerator generates the ULIDs of the created store and models instead of OpenFGA's random ones, see WithIDGenerator
+	datastore              storage.OpenFGADatastore // datastore is the datastore of the server, the injected Datastore or the opened sqlite one
+	db                     *sql.DB                  // db is the connection of the primary sqlite datastore
+	readServer             *server.Server           // readServer is the OpenFGA server on the read replica datastore, nil without a replica
+	readDatastore          storage.OpenFGADatastore // readDatastore is the read replica datastore, nil without a replica
+	readDB                 *sql.DB                  // readDB is the connection of the read replica datastore
+	logger                 logger.Logger            // logger is the zap2Slog adapter shared with the OpenFGA server
+	stats                  counters                 // stats are the operation counters returned by Stats
+	checkLatency           *latencyHistogram        // checkLatency is the Check latency histogram, nil unless WithObservedCheckLatency is used
+	observeCheckLatency    func(time.Duration)      // observeCheckLatency is an optional callback receiving every Check duration
+	limiter                *requestLimiter          // limiter enforces MaxConcurrentRequests, nil when unbounded
+	writeSem               *semaphore.Weighted      // writeSem serializes the datastore writes of the server, see lockWrites
+	checkCache             checkCache               // checkCache holds the Check decisions of the PerTypeCacheTTL object types
+	authorizationModelID   string                   // authorizationModelID is the ID of the active authorization model, read it with ActiveModelID
+	schemaVersion          string                   // schemaVersion is the schema version of the active authorization model
+	modelMu                sync.RWMutex             // modelMu guards authorizationModelID and schemaVersion once the server is running
+	stopBackground         context.CancelFunc       // stopBackground cancels the background workers, it is called by Close
+	background             sync.WaitGroup           // background tracks the running background workers
+	changelog              changelogCursor          // changelog is the changelog position of StoreLastModified
 }
 
 type OpenFGAOption func(*OpenFGAServer) error
@@ -103,6 +189,21 @@ func WithMaxEvaluationCost(cost int) OpenFGAOption {
 	}
 }
 
+// WithConnMaxIdleTime sets how long a sqlite connection may stay idle before it is closed and reopened on demand
+// (default is 5 minutes), for both the datastore and the read replica. Recycling idle connections avoids stale
+// handles when the sqlite file is on a network mount. A duration of 0 keeps idle connections open indefinitely.
+func WithConnMaxIdleTime(d time.Duration) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if d < 0 {
+			return errors.New("connection max idle time must be greater than or equal to 0")
+		}
+		fga.ConnMaxIdleTime = d
+		return nil
+	}
+}
+
+// WithCacheTTL sets the TTL of the cache controller and the check query cache (default is 10 minutes). A TTL of 0
+// disables the caches, so every Check reads the datastore and sees the writes of other processes immediately.
 func WithCacheTTL(ttl time.Duration) OpenFGAOption {
 	return func(fga *OpenFGAServer) error {
 		if ttl < 0 {
@@ -113,6 +214,16 @@ func WithCacheTTL(ttl time.Duration) OpenFGAOption {
 	}
 }
 
+// WithCheckQueryCacheLimit caps the number of entries of the check query cache, the check iterator cache shares
+// the same storage and limit. Once full, the cache evicts entries with the W-TinyLFU policy: rarely requested
+// entries are evicted first, regardless of their TTL. A limit of 0 disables both caches.
+func WithCheckQueryCacheLimit(limit uint32) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.CheckQueryCacheLimit = limit
+		return nil
+	}
+}
+
 func WithCacheTTLString(ttl string) OpenFGAOption {
 	return func(fga *OpenFGAServer) error {
 		if ttl == "" {
@@ -130,87 +241,411 @@ func WithCacheTTLString(ttl string) OpenFGAOption {
 	}
 }
 
-func NewOpenFGA(dataStoreURI string, opts ...OpenFGAOption) (*OpenFGAServer, error) {
+// WithModelHotReload watches the model file at path and, on change, validates it and writes it as a new model
+// version which becomes the active model (see ActiveModelID). An invalid model is logged and the previous
+// model is kept. It is meant for development, where it avoids restarting the app on every model change.
+func WithModelHotReload(path string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if path == "" {
+			return errors.New("model hot-reload file cannot be empty")
+		}
+		fga.ModelHotReloadFile = path
+		return nil
+	}
+}
+
+// WithReadReplicaURI routes Check and ListObjects to a second, read-only datastore while writes go to the
+// primary one. Reads are eventually consistent: a write is only visible once it is replicated, and the read
+// server has its own check query cache, so a cached decision may additionally live for up to CacheTTL after
+// the replica caught up. A model written at startup must be replicated before Checks succeed on the replica.
+func WithReadReplicaURI(uri string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if uri == "" {
+			return errors.New("read replica URI cannot be empty")
+		}
+		fga.ReadReplicaURI = uri
+		return nil
+	}
+}
+
+// WithCacheWarming starts a background worker after startup that pre-issues Checks for the given tuples and for
+// the tuples of the most recent changes, so that the check query cache is hot right after a cold start.
+func WithCacheWarming(objects []Tuple) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.CacheWarming = true
+		fga.CacheWarmingTuples = objects
+		return nil
+	}
+}
+
+// WithWarmup issues a throwaway Check of the first initial tuple at the end of the construction and logs its
+// latency, so the model compilation and the cache initialization of the first Check are paid at boot instead of
+// by the first user. A failing warm-up Check is logged, it does not fail the construction.
+func WithWarmup(enabled bool) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.Warmup = enabled
+		return nil
+	}
+}
+
+// WithExpirySweeper starts a background worker deleting the expired temporary grants (see GrantTemporary) every
+// interval. Each sweep pages through all the tuples of the store, so pick an interval matching the store size. The
+// expired grants of a page are deleted under the write lock, after reading them again.
+func WithExpirySweeper(interval time.Duration) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if interval <= 0 {
+			return errors.New("expiry sweep interval must be greater than 0")
+		}
+		fga.ExpirySweepInterval = interval
+		return nil
+	}
+}
+
+// WithAssertionsCheck makes NewOpenFGA load the assertions file next to the model file (see AssertionsFile)
+// after seeding the initial tuples, and fail if any of the expected Check outcomes does not match.
+func WithAssertionsCheck(enabled bool) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.AssertionsCheck = enabled
+		return nil
+	}
+}
+
+// WithSelfTest makes NewOpenFGA run SelfTest with the expectations after seeding the initial tuples, and fail if
+// any of the expected Check outcomes does not match.
+func WithSelfTest(expectations []Expectation) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if len(expectations) == 0 {
+			return errors.New("self test expectations cannot be empty")
+		}
+		fga.SelfTestExpectations = expectations
+		return nil
+	}
+}
+
+// BootstrapFunc creates or looks up the store and the authorization model on the OpenFGA server and returns
+// their IDs.
+type BootstrapFunc func(ctx context.Context, srv *server.Server) (storeID, modelID string, err error)
+
+// WithMaxConcurrentRequests bounds the number of concurrent requests sent to the OpenFGA server or the datastore,
+// e.g. to keep a thundering herd of Checks on a cold cache from exhausting the small sqlite connection pool. The
+// requests beyond n wait for a free slot, unless WithRequestQueueing(false) is used. Every method of the server
+// and the expiry sweeper take a slot per request, a method paging through Read takes one per page. The startup
+// and the model hot reload are not limited.
+func WithMaxConcurrentRequests(n int64) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if n <= 0 {
+			return errors.New("max concurrent requests must be greater than 0")
+		}
+		fga.MaxConcurrentRequests = n
+		return nil
+	}
+}
+
+// WithDatastoreRetry retries a failed datastore connection at startup up to attempts times, waiting backoff before
+// the first retry and doubling the wait at every retry up to 10 seconds (default is 5 attempts and 100ms), so a
+// datastore briefly unavailable while the app starts, e.g. during orchestration, does not fail the startup. The
+// retries stop at the 30 seconds startup timeout. 0 attempts fails at the first connection error.
+func WithDatastoreRetry(attempts int, backoff time.Duration) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if attempts < 0 {
+			return errors.New("datastore retry attempts must be greater than or equal to 0")
+		}
+		if backoff <= 0 {
+			return errors.New("datastore retry backoff must be greater than 0")
+		}
+		fga.DatastoreRetryAttempts = attempts
+		fga.DatastoreRetryBackoff = backoff
+		return nil
+	}
+}
+
+// WithListObjectsDeadline bounds the time the server spends evaluating a ListObjects (default is 3 seconds), so an
+// expensive listing cannot run unbounded. ListObjects returns the objects found until the deadline together with
+// ErrListObjectsDeadlineExceeded (see ListObjects). A deadline of 0 lets a ListObjects run until its context is done.
+func WithListObjectsDeadline(d time.Duration) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if d < 0 {
+			return errors.New("list objects deadline must be greater than or equal to 0")
+		}
+		fga.ListObjectsDeadline = d
+		return nil
+	}
+}
+
+// WithListObjectsMaxResults caps the number of objects a ListObjects returns (default is 1000), the evaluation stops
+// once n objects are found. Which objects are returned when more match is not defined. 0 returns every object.
+func WithListObjectsMaxResults(n uint32) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.ListObjectsMaxResults = n
+		return nil
+	}
+}
+
+// WithRequestQueueing sets whether the requests beyond WithMaxConcurrentRequests wait for a free slot (default)
+// or fail immediately with ErrServerBusy.
+func WithRequestQueueing(enabled bool) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.QueueRequests = enabled
+		return nil
+	}
+}
+
+// WithBootstrap replaces the default store lookup and model write sequence of NewOpenFGA with a custom one,
+// e.g. to fetch the model from a config service. It runs after the migrations, once the datastore and the
+// server are ready, and before the initial tuples are written to the returned store. StoreName and ModelFile
+// are still required: the initial tuples are validated against the model file before the datastore is opened.
+// The model hot reload writes its models to the returned store, with the IDs of the IDGenerator if set.
+func WithBootstrap(bootstrap BootstrapFunc) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if bootstrap == nil {
+			return errors.New("bootstrap cannot be nil")
+		}
+		fga.Bootstrap = bootstrap
+		return nil
+	}
+}
+
+// WithUniqueStoreName makes NewOpenFGA fail when more than one store already exists with the configured name,
+// instead of silently binding to the first one.
+func WithUniqueStoreName(unique bool) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.UniqueStoreName = unique
+		return nil
+	}
+}
+
+// WithStoreNamePrefix namespaces the store name, the store is looked up and created as prefix + StoreName.
+// Several applications sharing one datastore file can use the same store name with different prefixes,
+// an empty prefix uses the store name as is.
+func WithStoreNamePrefix(prefix string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.StoreNamePrefix = prefix
+		return nil
+	}
+}
+
+// WithPerTypeCacheTTL sets the Check decision TTL per object type, e.g. 0 for "app" to always check admin
+// access against the datastore and an hour for "document" views. Unlisted types use the global CacheTTL.
+//
+// The check query cache of OpenFGA has a single TTL per server, so the listed types bypass it and their
+// decisions are cached in-process with the type TTL instead. The cache controller only invalidates the
+// OpenFGA cache: the per-type cache is dropped on every write through this server, while writes made by
+// other processes sharing the datastore are only seen once the type TTL expires. The per-type cache keeps
+// at most 10000 decisions, the least recently used one is evicted first.
+func WithPerTypeCacheTTL(ttls map[string]time.Duration) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		for objectType, ttl := range ttls {
+			if ttl < 0 {
+				return errors.Errorf("cache TTL of type %q cannot be negative", objectType)
+			}
+		}
+		fga.PerTypeCacheTTL = ttls
+		return nil
+	}
+}
+
+// WithObservedCheckLatency records the duration of every Check in a histogram whose p50/p95/p99 are reported
+// by Stats. The optional observe callback receives each duration as well, e.g. to feed an external histogram.
+func WithObservedCheckLatency(observe func(d time.Duration)) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.checkLatency = &latencyHistogram{}
+		fga.observeCheckLatency = observe
+		return nil
+	}
+}
+
+// WithDatastore makes NewOpenFGA use the given datastore instead of opening the sqlite datastore at the datastore
+// URI, e.g. a storage/memory datastore or a fake in unit tests. The datastore must be migrated already, its
+// ownership is transferred: Close closes it, or NewOpenFGA when it fails. The sqlite maintenance operations (e.g.
+// Backup) are not available.
+func WithDatastore(ds storage.OpenFGADatastore) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if ds == nil {
+			return errors.New("datastore cannot be nil")
+		}
+		fga.Datastore, fga.datastore = ds, ds
+		return nil
+	}
+}
+
+// WithDebugDecisions enables a structured debug log entry for each Check with the object, relation, user,
+// the decision and its latency. It is off by default to avoid log spam.
+func WithDebugDecisions(enabled bool) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.DebugDecisions = enabled
+		return nil
+	}
+}
+
+// WithTraceIDContextKey attaches the value stored under key in the request context, e.g. a request or trace ID set
+// by a middleware, as the "trace_id" attribute of every record the OpenFGA server logs for the request, so all the
+// logs of a single request can be correlated. The context of the calls is propagated into the server.
+func WithTraceIDContextKey(key any) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if key == nil {
+			return errors.New("trace ID context key cannot be nil")
+		}
+		fga.TraceIDContextKey = key
+		return nil
+	}
+}
+
+// WithLogSampling logs only the first and then every n-th debug and info record of each message the OpenFGA
+// server logs, including the check decisions of WithDebugDecisions, to keep the log volume bounded under load.
+// Warnings and errors are always logged. A value of 1 logs every record. See embeddfga.LogSampler for the bound
+// on the number of messages counted separately.
+func WithLogSampling(n uint64) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if n == 0 {
+			return errors.New("log sampling must be greater than 0")
+		}
+		fga.LogSampling = n
+		return nil
+	}
+}
+
+// WithStoreID creates the store with the given ID instead of a random ULID, or uses the store with that ID if it
+// exists, e.g. for golden-file tests over the store metadata. The ID must be a ULID, e.g.
+// "01ARZ3NDEKTSV4RRFFQ69G5FAV", and the store must be named StoreName. It is ignored by a custom Bootstrap.
+func WithStoreID(id string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if err := (&openfgav1.GetStoreRequest{StoreId: id}).Validate(); err != nil {
+			return errors.Wrap(err, "invalid store ID")
+		}
+		fga.StoreID = id
+		return nil
+	}
+}
+
+// WithLifecycleHook calls hook when a bootstrap step completes: the migrations of the datastore were run
+// (MigrationsRun), the store was created or found (StoreCreated, StoreFound) and the authorization model was written
+// or found (ModelCreated, ModelFound), with the store or model ID and the duration of the step. It gives a single
+// place to hook the bootstrap telemetry. The hook is called synchronously during NewOpenFGA, it is not called by a
+// custom Bootstrap.
+func WithLifecycleHook(hook func(event LifecycleEvent)) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if hook == nil {
+			return errors.New("lifecycle hook cannot be nil")
+		}
+		fga.LifecycleHook = hook
+		return nil
+	}
+}
+
+// WithIDGenerator generates the IDs of the store created at startup and of the authorization models written by
+// the bootstrap and the model hot reload with gen instead of OpenFGA's random ULIDs, e.g. for deterministic tests
+// or IDs agreed on across regions. The IDs must be ULIDs and keep increasing, the latest model being the one with
+// the highest ID. Collisions are the caller's responsibility: a duplicated ID fails the write. A custom Bootstrap
+// does not use it and creates its own IDs, the model hot reload still uses it.
+func WithIDGenerator(gen func() string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if gen == nil {
+			return errors.New("ID generator cannot be nil")
+		}
+		fga.IDGenerator = gen
+		return nil
+	}
+}
+
+// WithAutoMigrate enables or disables running the pending migrations of the sqlite datastore at startup (default
+// is true). When disabled, NewOpenFGA fails with embeddfga.ErrMigrationsRequired instead, so that the migrations can
+// be run in a controlled step, e.g. with Migrate. It does not apply to an injected datastore.
+func WithAutoMigrate(autoMigrate bool) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		fga.AutoMigrate = autoMigrate
+		return nil
+	}
+}
+
+func NewOpenFGA(dataStoreURI string, opts ...OpenFGAOption) (_ *OpenFGAServer, err error) {
 	fga := &OpenFGAServer{
-		dataStoreURI:      dataStoreURI,
-		MaxEvaluationCost: 100,              // OpenFGA default max evaluation cost
-		CacheTTL:          10 * time.Minute, // Default cache TTL
+		dataStoreURI:           dataStoreURI,
+		MaxEvaluationCost:      100,              // OpenFGA default max evaluation cost
+		CacheTTL:               10 * time.Minute, // Default cache TTL
+		CheckQueryCacheLimit:   10000,            // OpenFGA default check cache limit
+		QueueRequests:          true,
+		AutoMigrate:            true,
+		ConnMaxIdleTime:        5 * time.Minute,        // Default idle time before a sqlite connection is recycled
+		ListObjectsDeadline:    3 * time.Second,        // OpenFGA default list objects deadline
+		ListObjectsMaxResults:  1000,                   // OpenFGA default list objects max results
+		DatastoreRetryAttempts: 5,                      // Retries of a datastore briefly unavailable at startup
+		DatastoreRetryBackoff:  100 * time.Millisecond, // Doubled at every retry
 	}
+	// a single startup timeout bounds the waits for the datastore and the server, retries included
+	timeout := time.After(startupTimeout)
+	// on error, close what was opened so far: the datastores, the servers and the background workers
+	defer func() {
+		if err != nil {
+			err = stderrors.Join(err, fga.Close())
+		}
+	}()
 	for _, opt := range opts {
 		if err := opt(fga); err != nil {
 			return nil, errors.Wrap(err, "failed to apply OpenFGA option")
 		}
 	}
-	// 1. Validate server options
-	v := validator.New()
-	err := v.Struct(fga)
-	if err != nil {
-		return nil, errors.Wrap(err, "OpenFGA server configuration validation failed")
+	// 1. Validate server options, a missing model file is reported before the datastore is touched
+	if err := validateConfig(fga); err != nil {
+		return nil, err
+	}
+	if fga.dataStoreURI == "" && fga.Datastore == nil {
+		return nil, errors.New("datastore URI cannot be empty without an injected datastore")
+	}
+	if len(fga.StoreTags) > 0 && fga.Datastore != nil {
+		return nil, errors.New("store tags require the sqlite datastore, not an injected one")
+	}
+	fga.limiter = newRequestLimiter(fga.MaxConcurrentRequests, fga.QueueRequests)
+	fga.writeSem = semaphore.NewWeighted(1)
+	if fga.ModelFile != "" && fga.ModelDir != "" {
+		return nil, errors.New("model file and model directory are mutually exclusive")
+	}
+	var model *openfgav1.AuthorizationModel
+	if fga.ModelDir != "" {
+		model, err = readModelDir(fga.ModelDir)
+	} else {
+		model, err = readModelFile(fga.ModelFile)
 	}
-
-	// 2. Setup datastore
-	confg := sqlcommon.NewConfig()
-	pgConfig, err := sqlite.New(
-		fga.dataStoreURI,
-		confg,
-	)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create datastore")
+		return nil, err
+	}
+	// a tuple not matching the model would only fail when written, after the datastore is set up
+	if err := embeddfga.ValidateTuplesAgainstModel(model, fga.InitialTuples); err != nil {
+		slog.Error("Initial tuples do not match the authorization model", slog.String("model_file", fga.modelPath()), slog.Any("err", err))
+		return nil, errors.Wrap(err, "invalid initial tuples")
 	}
 
-	timeout := time.After(30 * time.Second)
-	for {
-		r, err := pgConfig.IsReady(context.Background())
-		if err != nil {
-			return nil, errors.Wrap(err, "error waiting for datastore to be ready")
-		}
-		if r.IsReady {
-			slog.Debug("datastore is ready")
-			break
-		} else if strings.Contains(r.Message, "datastore requires migrations") {
-			// 3. Run migration
-			slog.Warn("datastore requires migrations, running them now...")
-			err = Migrate(context.Background(), fga.dataStoreURI)
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to run migrations")
-			}
-			slog.Info("datastore migrations completed")
-		}
-		select {
-		case <-time.After(1 * time.Second):
-			slog.Debug("Waiting for datastore to be ready...", slog.String("message", r.Message))
-		case <-timeout:
-			return nil, errors.New("timed out waiting for datastore to be ready")
+	// 2. Setup datastore, an injected datastore is used as is
+	if fga.datastore == nil {
+		if err := fga.openDatastore(timeout); err != nil {
+			return nil, err
 		}
 	}
+	ds := fga.datastore
 
 	// 3. Run migration
 
 	viper.Set("maxConditionEvaluationCost", fga.MaxEvaluationCost) // use this wisely, it is a global setting and can have performance implications for slower modelsl
 	// 4. Initialize OpenFGA server
 	l := zap2Slog{
-		slog: slog.Default().Handler(),
-	}
-	fgaServer, err := server.NewServerWithOpts(
-		server.WithDatastore(pgConfig),
-		server.WithLogger(l),
-		server.WithCacheControllerEnabled(true),
-		server.WithCacheControllerTTL(fga.CacheTTL),
-		server.WithCheckQueryCacheEnabled(true),
-		server.WithCheckQueryCacheTTL(fga.CacheTTL),
-		server.WithCheckIteratorCacheEnabled(true),
-		server.WithMaxChecksPerBatchCheck(5000),
-		server.WithContextPropagationToDatastore(true),
-		server.WithMaxChecksPerBatchCheck(5000),
-	)
+		slog:       slog.Default().Handler(),
+		traceIDKey: fga.TraceIDContextKey,
+	}
+	if fga.LogSampling > 1 {
+		l.sampler = embeddfga.NewLogSampler(fga.LogSampling)
+	}
+	fga.logger = l
+	fga.Server, err = server.NewServerWithOpts(fga.serverOptions(ds)...)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to initialize OpenFGA server")
 	}
-	timeout = time.After(30 * time.Second)
-	for {
-		isReady, err := fgaServer.IsReady(context.Background())
+	for attempt := 1; ; {
+		isReady, err := fga.Server.IsReady(context.Background())
 		if err != nil {
-			return nil, errors.Wrap(err, "error checking OpenFGA server readiness")
+			if err := fga.waitDatastoreRetry(attempt, err, timeout); err != nil {
+				return nil, errors.Wrap(err, "error checking OpenFGA server readiness")
+			}
+			attempt++
+			continue
 		}
 		if isReady {
 			slog.Debug("OpenFGA server is ready")
@@ -224,115 +659,910 @@ func NewOpenFGA(dataStoreURI string, opts ...OpenFGAOption) (*OpenFGAServer, err
 		}
 	}
 
-	fga.Server = fgaServer
+	// 4b. Initialize the read replica server, replicas are read-only so they are never migrated
+	if fga.ReadReplicaURI != "" {
+		replicaDSN, err := sqlite.PrepareDSN(fga.ReadReplicaURI)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to prepare read replica datastore DSN")
+		}
+		fga.readDB, err = sql.Open("sqlite", replicaDSN)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open read replica datastore")
+		}
+		fga.readDB.SetConnMaxIdleTime(fga.ConnMaxIdleTime)
+		replica, err := sqlite.NewWithDB(fga.readDB, sqlcommon.NewConfig())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create read replica datastore")
+		}
+		fga.readDatastore = replica
+		r, err := replica.IsReady(context.Background())
+		if err != nil {
+			return nil, errors.Wrap(err, "error checking read replica datastore readiness")
+		}
+		if !r.IsReady {
+			return nil, errors.Errorf("read replica datastore is not ready: %s", r.Message)
+		}
+		fga.readServer, err = server.NewServerWithOpts(fga.serverOptions(replica)...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize OpenFGA read replica server")
+		}
+	}
 
-	// 5. Create or lookup the store
+	// 5. Create or lookup the store and the authorization model
+	bootstrap := fga.Bootstrap
+	if bootstrap == nil {
+		bootstrap = fga.defaultBootstrap(model, ds)
+	}
+	storeID, modelID, err := bootstrap(context.Background(), fga.Server)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to bootstrap the store and the authorization model")
+	}
+	// 6. Bind to the bootstrapped model, reading it also checks that the returned IDs exist
+	m, err := fga.Server.ReadAuthorizationModel(context.Background(), &openfgav1.ReadAuthorizationModelRequest{
+		StoreId: storeID,
+		Id:      modelID,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the bootstrapped authorization model %s of store %s", modelID, storeID)
+	}
+	fga.StoreID = storeID
+	fga.setActiveModel(modelID, m.GetAuthorizationModel().GetSchemaVersion())
+	if len(fga.StoreTags) > 0 {
+		if err := fga.writeStoreTags(context.Background()); err != nil {
+			return nil, err
+		}
+	}
 
-	stores, err := fga.Server.ListStores(context.Background(), &openfgav1.ListStoresRequest{Name: fga.StoreName})
+	// 7. Import initial tuples to OpenFGA
+	err = fga.Write(context.Background(), fga.InitialTuples, true) // we ignore existing tuples
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to list stores")
+		return nil, errors.Wrap(err, "failed to write tuples to OpenFGA")
 	}
-	if len(stores.Stores) == 0 {
-		cs, err := fga.Server.CreateStore(context.Background(), &openfgav1.CreateStoreRequest{
-			Name: fga.StoreName,
-		})
+
+	if fga.Warmup {
+		fga.warmup(context.Background())
+	}
+
+	// 8. Validate the model and the tuples against the assertions
+	if fga.AssertionsCheck {
+		assertions, err := LoadAssertions(AssertionsFile(fga.modelPath()))
 		if err != nil {
-			slog.Error("Failed to create store", slog.Any("err", err))
-			return nil, errors.Wrap(err, "failed to create store")
+			return nil, errors.Wrap(err, "failed to load model assertions")
 		}
-		fga.StoreID = cs.GetId()
-		slog.Debug("Store created", slog.String("id", fga.StoreID))
-	} else {
-		fga.StoreID = stores.Stores[0].GetId()
-		slog.Info("Store found", slog.String("id", fga.StoreID))
+		if err := fga.RunAssertions(context.Background(), assertions); err != nil {
+			return nil, errors.Wrap(err, "model assertions check failed")
+		}
+		slog.Info("Model assertions passed", slog.Int("count", len(assertions)))
+	}
+	if len(fga.SelfTestExpectations) > 0 {
+		if err := fga.SelfTest(context.Background(), fga.SelfTestExpectations); err != nil {
+			return nil, err
+		}
+		slog.Info("Self test passed", slog.Int("count", len(fga.SelfTestExpectations)))
 	}
 
-	// 6. Create or lookup the authorization model
-	modelData, err := os.ReadFile(fga.ModelFile)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to read model file")
+	// 9. Start the background workers
+	var bgCtx context.Context
+	bgCtx, fga.stopBackground = context.WithCancel(context.Background())
+	if fga.ModelHotReloadFile != "" {
+		watcher, err := newModelWatcher(fga.ModelHotReloadFile)
+		if err != nil {
+			return nil, err
+		}
+		fga.background.Add(1)
+		go func() {
+			defer fga.background.Done()
+			fga.watchModelFile(bgCtx, watcher)
+		}()
+	}
+	if fga.CacheWarming {
+		fga.background.Add(1)
+		go func() {
+			defer fga.background.Done()
+			fga.warmCache(bgCtx)
+		}()
+	}
+	if fga.ExpirySweepInterval > 0 {
+		fga.background.Add(1)
+		go func() {
+			defer fga.background.Done()
+			fga.sweepExpiredGrants(bgCtx, fga.ExpirySweepInterval)
+		}()
 	}
 
-	model, err := parser.TransformDSLToProto(string(modelData))
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to transform DSL to OpenFGA model")
+	return fga, nil
+
+}
+
+// defaultBootstrap returns the bootstrap looking up the store by name, or by the ID of WithStoreID, or creating it,
+// and its latest authorization model, or writing the model when the store has none (see embeddfga.Bootstrap).
+func (fga *OpenFGAServer) defaultBootstrap(model *openfgav1.AuthorizationModel, ds storage.OpenFGADatastore) BootstrapFunc {
+	return func(ctx context.Context, srv *server.Server) (storeID, modelID string, err error) {
+		return embeddfga.Bootstrap(ctx, srv, embeddfga.BootstrapConfig{
+			StoreName:       fga.StoreNamePrefix + fga.StoreName,
+			StoreID:         fga.StoreID,
+			Datastore:       ds,
+			UniqueStoreName: fga.UniqueStoreName,
+			Model:           model,
+			NewID:           fga.IDGenerator,
+			Hook:            fga.LifecycleHook,
+		})
 	}
+}
 
-	models, err := fga.Server.ReadAuthorizationModels(context.Background(), &openfgav1.ReadAuthorizationModelsRequest{
-		StoreId: fga.StoreID,
-	})
+// waitDatastoreRetry waits before the given retry of a failed datastore connection, 1 for the first retry. It
+// returns the connection error once the DatastoreRetryAttempts are exhausted or the startup timeout fires.
+func (fga *OpenFGAServer) waitDatastoreRetry(attempt int, err error, timeout <-chan time.Time) error {
+	if attempt > fga.DatastoreRetryAttempts {
+		return err
+	}
+	backoff := fga.DatastoreRetryBackoff
+	for range attempt - 1 {
+		backoff = min(2*backoff, maxDatastoreRetryBackoff)
+	}
+	slog.Warn("Datastore unavailable, retrying",
+		slog.Int("attempt", attempt), slog.Duration("backoff", backoff), slog.Any("err", err))
+	select {
+	case <-time.After(backoff):
+		return nil
+	case <-timeout:
+		return errors.Wrap(err, "timed out retrying the datastore connection")
+	}
+}
+
+// openDatastore opens the sqlite datastore at dataStoreURI and runs the migrations if it requires them and
+// AutoMigrate is set, the connection is kept for the sqlite maintenance operations (e.g. Backup). The datastore
+// and its connection are set as soon as opened, so Close closes them even when the datastore is not ready. The
+// wait for the datastore gives up when the startup timeout fires.
+func (fga *OpenFGAServer) openDatastore(timeout <-chan time.Time) error {
+	dsn, err := sqlite.PrepareDSN(fga.dataStoreURI)
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare datastore DSN")
+	}
+	fga.db, err = sql.Open("sqlite", dsn)
+	if err != nil {
+		return errors.Wrap(err, "failed to open datastore")
+	}
+	fga.db.SetConnMaxIdleTime(fga.ConnMaxIdleTime)
+	confg := sqlcommon.NewConfig()
+	pgConfig, err := sqlite.NewWithDB(
+		fga.db,
+		confg,
+	)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to read authorization models")
+		return errors.Wrap(err, "failed to create datastore")
 	}
+	fga.datastore = pgConfig
 
-	if len(models.GetAuthorizationModels()) == 0 {
-		r, err := fga.Server.WriteAuthorizationModel(context.Background(), &openfgav1.WriteAuthorizationModelRequest{
-			StoreId:         fga.StoreID,
-			SchemaVersion:   model.GetSchemaVersion(),
-			TypeDefinitions: model.GetTypeDefinitions(),
-			Conditions:      model.GetConditions(), // in this demo we don't use conditions, but you can add them and use them in your model
-		})
+	for attempt := 1; ; {
+		r, err := pgConfig.IsReady(context.Background())
+		if err != nil {
+			if err := fga.waitDatastoreRetry(attempt, err, timeout); err != nil {
+				return errors.Wrap(err, "error waiting for datastore to be ready")
+			}
+			attempt++
+			continue
+		}
+		// the readiness status only carries a human-readable message, the schema version tells whether
+		// the datastore is not ready because it requires migrations, or was migrated further by a newer OpenFGA
+		// while still reporting ready
+		current, err := embeddfga.SchemaVersion(context.Background(), "sqlite", fga.dataStoreURI)
 		if err != nil {
-			slog.Error("Failed to write authorization model", slog.Any("err", err))
-			return nil, errors.Wrap(err, "failed to write authorization model")
+			return errors.Wrap(err, "failed to read datastore schema version")
+		}
+		if current > embeddfga.SqliteSchemaVersion {
+			return errors.Wrapf(embeddfga.ErrUnsupportedSchemaVersion, "datastore schema v%d, server expects v%d", current, embeddfga.SqliteSchemaVersion)
+		}
+		if r.IsReady {
+			slog.Debug("datastore is ready", slog.String("uri", embeddfga.RedactURI(fga.dataStoreURI)))
+			break
+		}
+		if current < embeddfga.SqliteSchemaVersion {
+			if !fga.AutoMigrate {
+				return errors.Wrapf(embeddfga.ErrMigrationsRequired, "schema version is %d, expected %d", current, embeddfga.SqliteSchemaVersion)
+			}
+			// 3. Run migration
+			slog.Warn("datastore requires migrations, running them now...", slog.String("uri", embeddfga.RedactURI(fga.dataStoreURI)))
+			start := time.Now()
+			err = Migrate(context.Background(), fga.dataStoreURI)
+			if err != nil {
+				return errors.Wrap(err, "failed to run migrations")
+			}
+			slog.Info("datastore migrations completed")
+			embeddfga.Emit(fga.LifecycleHook, embeddfga.MigrationsRun, "", start)
+		}
+		select {
+		case <-time.After(1 * time.Second):
+			slog.Debug("Waiting for datastore to be ready...", slog.String("message", r.Message))
+		case <-timeout:
+			return errors.New("timed out waiting for datastore to be ready")
 		}
-		fga.AuthorizationModelID = r.GetAuthorizationModelId()
-		slog.Debug("Authorization model created", slog.String("model_id", fga.AuthorizationModelID))
-	} else {
-		fga.AuthorizationModelID = models.GetAuthorizationModels()[0].GetId()
-		slog.Debug("Authorization model found", slog.String("model_id", fga.AuthorizationModelID))
 	}
+	return nil
+}
 
-	// 7. Import initial tuples to OpenFGA
-	err = fga.Write(context.Background(), fga.InitialTuples, true) // we ignore existing tuples
+// modelPath returns the model directory of a modular model, or the model file otherwise.
+func (fga *OpenFGAServer) modelPath() string {
+	if fga.ModelDir != "" {
+		return fga.ModelDir
+	}
+	return fga.ModelFile
+}
+
+// readModelFile reads and parses the model DSL file, an empty or whitespace-only file is rejected upfront
+// because the parser does not report it clearly.
+func readModelFile(path string) (*openfgav1.AuthorizationModel, error) {
+	modelData, err := os.ReadFile(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to write tuples to OpenFGA")
+		return nil, errors.Wrap(err, "failed to read model file")
 	}
+	if strings.TrimSpace(string(modelData)) == "" {
+		return nil, errors.Errorf("model file is empty: %s", path)
+	}
+	return cachedModel(func() (*openfgav1.AuthorizationModel, error) {
+		model, err := parser.TransformDSLToProto(string(modelData))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to transform DSL to OpenFGA model")
+		}
+		return model, nil
+	}, string(modelData))
+}
 
-	return fga, nil
+// serverOptions returns the OpenFGA server options for the given datastore.
+func (fga *OpenFGAServer) serverOptions(ds storage.OpenFGADatastore) []server.OpenFGAServiceV1Option {
+	opts := []server.OpenFGAServiceV1Option{
+		server.WithDatastore(embeddfga.KeepOpenDatastore{OpenFGADatastore: ds}), // Close closes the datastore to report its errors
+		server.WithLogger(fga.logger),
+		server.WithMaxChecksPerBatchCheck(batchCheckSize),
+		server.WithContextPropagationToDatastore(true),
+		server.WithListObjectsDeadline(listObjectsServerDeadline(fga.ListObjectsDeadline)),
+		server.WithListObjectsMaxResults(fga.ListObjectsMaxResults),
+	}
+	// a CacheTTL of 0 disables the caches, every Check reads the datastore
+	cacheEnabled := fga.CacheTTL > 0
+	opts = append(opts,
+		server.WithCacheControllerEnabled(cacheEnabled),
+		server.WithCheckQueryCacheEnabled(cacheEnabled),
+		server.WithCheckIteratorCacheEnabled(cacheEnabled),
+	)
+	if cacheEnabled {
+		opts = append(opts,
+			server.WithCacheControllerTTL(fga.CacheTTL),
+			server.WithCheckQueryCacheTTL(fga.CacheTTL),
+			server.WithCheckCacheLimit(fga.CheckQueryCacheLimit),
+		)
+	}
+	return opts
+}
 
+// reader returns the server used for read operations, the read replica when one is configured.
+func (fga *OpenFGAServer) reader() *server.Server {
+	if fga.readServer != nil {
+		return fga.readServer
+	}
+	return fga.Server
 }
 
 func (fga *OpenFGAServer) Check(ctx context.Context, t Tuple) (bool, error) {
-	v, err1 := fga.Server.Check(ctx, &openfgav1.CheckRequest{
+	return fga.CheckAgainstModel(ctx, fga.ActiveModelID(), t)
+}
+
+// CheckAgainstModel evaluates the tuple against the given authorization model instead of the current one.
+// Evaluating the same tuple against the current and a candidate model allows shadow-testing a model change
+// against production traffic before promoting it.
+func (fga *OpenFGAServer) CheckAgainstModel(ctx context.Context, modelID string, t Tuple) (bool, error) {
+	return fga.check(ctx, modelID, t, nil)
+}
+
+// CheckWithCondition evaluates the tuple against the current model with the given condition context, it
+// provides the parameters of the conditions the tuples are granted under (e.g. the current time of a time
+// window condition). The decisions depend on the context, so they are never cached by PerTypeCacheTTL.
+func (fga *OpenFGAServer) CheckWithCondition(ctx context.Context, t Tuple, conditionContext map[string]any) (bool, error) {
+	checkContext, err := structpb.NewStruct(conditionContext)
+	if err != nil {
+		return false, errors.Wrap(err, "invalid condition context")
+	}
+	return fga.check(ctx, fga.ActiveModelID(), t, checkContext)
+}
+
+func (fga *OpenFGAServer) check(ctx context.Context, modelID string, t Tuple, checkContext *structpb.Struct) (bool, error) {
+	if modelID == "" {
+		return false, errors.New("authorization model ID cannot be empty")
+	}
+	consistency := openfgav1.ConsistencyPreference_UNSPECIFIED
+	cacheKey := checkCacheKey{modelID: modelID, tuple: t.ID()}
+	typeTTL, perType := fga.PerTypeCacheTTL[tuple.GetType(t.Object)]
+	perType = perType && checkContext == nil
+	var cacheGen uint64
+	if perType {
+		cacheGen = fga.checkCache.generation()
+		if allowed, ok := fga.checkCache.get(cacheKey); ok {
+			return allowed, nil
+		}
+		consistency = openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY
+	}
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	fga.stats.checks.Add(1)
+	start := time.Now()
+	v, err1 := fga.reader().Check(ctx, &openfgav1.CheckRequest{
 		StoreId:              fga.StoreID,
-		AuthorizationModelId: fga.AuthorizationModelID,
-		TupleKey:             tuple.NewCheckRequestTupleKey(t.Object, t.Relation, t.User),
+		AuthorizationModelId: modelID,
+		TupleKey:             t.CheckRequestTupleKey(),
+		Context:              checkContext,
+		Consistency:          consistency,
 	})
+	if fga.checkLatency != nil {
+		latency := time.Since(start)
+		fga.checkLatency.observe(latency)
+		if fga.observeCheckLatency != nil {
+			fga.observeCheckLatency(latency)
+		}
+	}
 	if err1 != nil {
+		fga.stats.checkErrors.Add(1)
+		if notFound := fga.checkNotFoundError(ctx, err1); notFound != nil {
+			return false, errors.Wrapf(notFound, "failed to check tuple in OpenFGA: %s", err1)
+		}
 		return false, errors.Wrap(err1, "failed to check tuple in OpenFGA")
 	}
+	if fga.DebugDecisions && fga.logger != nil {
+		fga.logger.DebugWithContext(ctx, "check decision",
+			zap.String("model_id", modelID),
+			zap.String("object", t.Object),
+			zap.String("relation", t.Relation),
+			zap.String("user", t.User),
+			zap.Bool("allowed", v.GetAllowed()),
+			zap.Duration("latency", time.Since(start)),
+		)
+	}
+	if perType {
+		fga.checkCache.set(cacheKey, v.GetAllowed(), typeTTL, cacheGen)
+	}
 	return v.GetAllowed(), nil
 }
 
+// Write writes the tuples in WriteRequests of at most writeBatchSize tuples, so any number of tuples can be
+// passed. The requests are not atomic with each other: on error the previous batches remain written.
+// All the tuples are validated before the first request is sent. Write is safe for concurrent use, the writes
+// of the server are serialized per request, see the README on concurrent writes.
 func (fga *OpenFGAServer) Write(ctx context.Context, t []Tuple, ignoreExisting bool) error {
 	if len(t) == 0 {
 		return errors.New("no tuples provided to write")
 	}
+	for _, tpl := range t {
+		if err := tpl.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tuple")
+		}
+	}
+	for start := 0; start < len(t); start += writeBatchSize {
+		if err := fga.writeBatch(ctx, t[start:min(start+writeBatchSize, len(t))], ignoreExisting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureTuples writes the tuples not already present in the store, e.g. to seed new default grants after a
+// deploy. Unlike Write with ignoreExisting, an existing tuple does not abort its whole batch: every tuple is
+// looked up with Read first and only the missing ones are written. Duplicates in tuples are written once.
+func (fga *OpenFGAServer) EnsureTuples(ctx context.Context, tuples []Tuple) error {
+	seen := make(map[TupleID]struct{}, len(tuples))
+	var missing []Tuple
+	for _, t := range tuples {
+		if err := t.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tuple")
+		}
+		if _, ok := seen[t.ID()]; ok {
+			continue
+		}
+		seen[t.ID()] = struct{}{}
+		existing, err := fga.readTuples(ctx, &openfgav1.ReadRequestTupleKey{Object: t.Object, Relation: t.Relation, User: t.User})
+		if err != nil {
+			return err
+		}
+		if len(existing) == 0 {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	slog.Info("Writing missing tuples", slog.Int("missing", len(missing)), slog.Int("total", len(seen)))
+	return fga.Write(ctx, missing, false)
+}
+
+func (fga *OpenFGAServer) writeBatch(ctx context.Context, t []Tuple, ignoreExisting bool) error {
 	var tupleKeys []*openfgav1.TupleKey
 	for _, tpl := range t {
-		tupleKeys = append(tupleKeys, tuple.NewTupleKey(tpl.Object, tpl.Relation, tpl.User))
+		tk, err := tpl.TupleKey()
+		if err != nil {
+			return errors.Wrap(err, "invalid tuple")
+		}
+		tupleKeys = append(tupleKeys, tk)
+	}
+	return fga.writeTupleKeys(ctx, tupleKeys, ignoreExisting)
+}
+
+// writeTupleKeys sends a single WriteRequest.
+func (fga *OpenFGAServer) writeTupleKeys(ctx context.Context, tupleKeys []*openfgav1.TupleKey, ignoreExisting bool) error {
+	// the write lock is taken first, so the writes waiting for it do not hold the request slots of the Checks
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
 	}
-	_, err := fga.Server.Write(ctx, &openfgav1.WriteRequest{
+	defer release()
+	fga.stats.writes.Add(1)
+	_, err = fga.Server.Write(ctx, &openfgav1.WriteRequest{
 		StoreId:              fga.StoreID,
-		AuthorizationModelId: fga.AuthorizationModelID,
+		AuthorizationModelId: fga.ActiveModelID(),
 		Writes: &openfgav1.WriteRequestWrites{
 			TupleKeys: tupleKeys,
 		},
 	})
+	fga.checkCache.invalidate()
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") && ignoreExisting { // if a batch write fails due to one exising pair the others won't be written, use this carefully
 			slog.Info("Tuple already exists, ignoring", slog.Any("err", err))
 			return nil
 		}
-		return errors.Wrap(err, "failed to write tuple to OpenFGA")
+		fga.stats.writeErrors.Add(1)
+		return writeError(ctx, err, "failed to write tuple to OpenFGA")
 	}
 	return nil
 }
 
+func (fga *OpenFGAServer) Delete(ctx context.Context, t []Tuple) error {
+	if len(t) == 0 {
+		return errors.New("no tuples provided to delete")
+	}
+	fga.stats.deletes.Add(1)
+	var tupleKeys []*openfgav1.TupleKeyWithoutCondition
+	for _, tpl := range t {
+		tupleKeys = append(tupleKeys, tpl.TupleKeyWithoutCondition())
+	}
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = fga.Server.Write(ctx, &openfgav1.WriteRequest{
+		StoreId:              fga.StoreID,
+		AuthorizationModelId: fga.ActiveModelID(),
+		Deletes: &openfgav1.WriteRequestDeletes{
+			TupleKeys: tupleKeys,
+		},
+	})
+	fga.checkCache.invalidate()
+	if err != nil {
+		fga.stats.deleteErrors.Add(1)
+		return writeError(ctx, err, "failed to delete tuple from OpenFGA")
+	}
+	return nil
+}
+
+// Refresh binds the server to the latest authorization model of the store, e.g. after Check returned
+// ErrModelNotFound because the model was updated elsewhere.
+func (fga *OpenFGAServer) Refresh(ctx context.Context) error {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	if _, err := fga.Server.GetStore(ctx, &openfgav1.GetStoreRequest{StoreId: fga.StoreID}); err != nil {
+		if notFound := notFoundError(err); notFound != nil {
+			return errors.Wrapf(notFound, "failed to get store: %s", err)
+		}
+		return errors.Wrap(err, "failed to get store")
+	}
+	models, err := fga.Server.ReadAuthorizationModels(ctx, &openfgav1.ReadAuthorizationModelsRequest{
+		StoreId: fga.StoreID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to read authorization models")
+	}
+	if len(models.GetAuthorizationModels()) == 0 {
+		return errors.Wrap(ErrModelNotFound, "no authorization model found in the store")
+	}
+	latest := models.GetAuthorizationModels()[0]
+	fga.setActiveModel(latest.GetId(), latest.GetSchemaVersion())
+	slog.Info("Authorization model refreshed", slog.String("model_id", fga.ActiveModelID()))
+	return nil
+}
+
+// Apply writes and deletes the tuples atomically in a single WriteRequest, e.g. to change a role (delete the
+// editor tuple, write the viewer one) without an intermediate state. Since a single request is used, the total
+// number of tuples cannot exceed writeBatchSize. It counts as one write in Stats.
+func (fga *OpenFGAServer) Apply(ctx context.Context, writes, deletes []Tuple) error {
+	if len(writes) == 0 && len(deletes) == 0 {
+		return errors.New("no tuples provided to apply")
+	}
+	if len(writes)+len(deletes) > writeBatchSize {
+		return errors.Errorf("cannot apply %d tuples atomically, the limit is %d", len(writes)+len(deletes), writeBatchSize)
+	}
+	for _, tpl := range writes {
+		if err := tpl.Validate(); err != nil {
+			return errors.Wrap(err, "invalid tuple")
+		}
+	}
+	fga.stats.writes.Add(1)
+	req := &openfgav1.WriteRequest{
+		StoreId:              fga.StoreID,
+		AuthorizationModelId: fga.ActiveModelID(),
+	}
+	if len(writes) > 0 {
+		req.Writes = &openfgav1.WriteRequestWrites{}
+		for _, tpl := range writes {
+			tk, err := tpl.TupleKey()
+			if err != nil {
+				return errors.Wrap(err, "invalid tuple")
+			}
+			req.Writes.TupleKeys = append(req.Writes.TupleKeys, tk)
+		}
+	}
+	if len(deletes) > 0 {
+		req.Deletes = &openfgav1.WriteRequestDeletes{}
+		for _, tpl := range deletes {
+			req.Deletes.TupleKeys = append(req.Deletes.TupleKeys, tpl.TupleKeyWithoutCondition())
+		}
+	}
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = fga.Server.Write(ctx, req)
+	fga.checkCache.invalidate()
+	if err != nil {
+		fga.stats.writeErrors.Add(1)
+		return writeError(ctx, err, "failed to apply tuples to OpenFGA")
+	}
+	return nil
+}
+
+// Close stops the background workers and closes the servers and their datastores. It returns the close failures
+// of the datastores joined, e.g. a datastore failing to flush, so a web server can log them during shutdown.
 func (fga *OpenFGAServer) Close() error {
+	if fga.stopBackground != nil {
+		fga.stopBackground()
+		fga.background.Wait()
+	}
+	// the servers and the datastores are closed separately, NewOpenFGA closes them when it fails half-way
+	var errs []error
+	if fga.readServer != nil {
+		fga.readServer.Close()
+		fga.readServer = nil
+	}
+	if fga.readDatastore != nil || fga.readDB != nil {
+		errs = append(errs, embeddfga.CloseDatastore(fga.readDatastore, fga.readDB))
+		fga.readDatastore, fga.readDB = nil, nil
+	}
 	if fga.Server != nil {
 		fga.Server.Close()
+		fga.Server = nil
 	}
-	return nil
+	if fga.datastore != nil || fga.db != nil {
+		errs = append(errs, embeddfga.CloseDatastore(fga.datastore, fga.db))
+		fga.datastore, fga.db = nil, nil
+	}
+	return stderrors.Join(errs...)
+}
+
+// CountTuples returns the total number of tuples in the store by paging through Read.
+// For huge stores a datastore-level count query is preferable, as this reads every tuple.
+func (fga *OpenFGAServer) CountTuples(ctx context.Context) (int64, error) {
+	var count int64
+	continuationToken := ""
+	for {
+		release, err := fga.limiter.acquire(ctx)
+		if err != nil {
+			return 0, err
+		}
+		r, err := fga.Server.Read(ctx, &openfgav1.ReadRequest{
+			StoreId:           fga.StoreID,
+			PageSize:          wrapperspb.Int32(readPageSize),
+			ContinuationToken: continuationToken,
+		})
+		release()
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read tuples from OpenFGA")
+		}
+		count += int64(len(r.GetTuples()))
+		continuationToken = r.GetContinuationToken()
+		if continuationToken == "" {
+			return count, nil
+		}
+	}
+}
+
+// SnapshotTuples returns all the tuples of the store with their conditions, paging through Read, e.g. to warm an
+// in-memory permission cache of the application from the authoritative store at boot. It is the read counterpart
+// of InitialTuples. The tuples written during the paging may or may not be included.
+func (fga *OpenFGAServer) SnapshotTuples(ctx context.Context) ([]Tuple, error) {
+	return fga.readTuples(ctx, nil)
+}
+
+// readTuples pages through Read and returns all the tuples matching the key, a nil key matches every tuple.
+func (fga *OpenFGAServer) readTuples(ctx context.Context, key *openfgav1.ReadRequestTupleKey) ([]Tuple, error) {
+	keys, err := fga.readTupleKeys(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var tuples []Tuple
+	for _, k := range keys {
+		tuples = append(tuples, embeddfga.FromTupleKey(k))
+	}
+	return tuples, nil
+}
+
+// readTupleKeys is readTuples keeping the condition context of the tuples.
+func (fga *OpenFGAServer) readTupleKeys(ctx context.Context, key *openfgav1.ReadRequestTupleKey) ([]*openfgav1.TupleKey, error) {
+	tuples, err := fga.readStoredTuples(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*openfgav1.TupleKey, 0, len(tuples))
+	for _, t := range tuples {
+		keys = append(keys, t.GetKey())
+	}
+	return keys, nil
+}
+
+// readStoredTuples pages through Read and returns the stored tuples matching the key, with their timestamps.
+func (fga *OpenFGAServer) readStoredTuples(ctx context.Context, key *openfgav1.ReadRequestTupleKey) ([]*openfgav1.Tuple, error) {
+	var tuples []*openfgav1.Tuple
+	continuationToken := ""
+	for {
+		release, err := fga.limiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r, err := fga.Server.Read(ctx, &openfgav1.ReadRequest{
+			StoreId:           fga.StoreID,
+			TupleKey:          key,
+			PageSize:          wrapperspb.Int32(readPageSize),
+			ContinuationToken: continuationToken,
+		})
+		release()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read tuples from OpenFGA")
+		}
+		tuples = append(tuples, r.GetTuples()...)
+		continuationToken = r.GetContinuationToken()
+		if continuationToken == "" {
+			return tuples, nil
+		}
+	}
+}
+
+// deleteInBatches deletes the tuples in WriteRequests of at most writeBatchSize tuples and returns the number
+// of deleted tuples. Batches are not atomic, on error the previous batches remain deleted.
+func (fga *OpenFGAServer) deleteInBatches(ctx context.Context, tuples []Tuple) (int, error) {
+	deleted := 0
+	for start := 0; start < len(tuples); start += writeBatchSize {
+		batch := tuples[start:min(start+writeBatchSize, len(tuples))]
+		if err := fga.Delete(ctx, batch); err != nil {
+			return deleted, err
+		}
+		deleted += len(batch)
+	}
+	return deleted, nil
+}
+
+// DeleteObjectTuples deletes every tuple granting a relation on the object (e.g. "document:1") and returns the
+// number of deleted tuples. Call it when the object is deleted, otherwise its grants would apply to a new
+// object created with the same id.
+func (fga *OpenFGAServer) DeleteObjectTuples(ctx context.Context, object string) (int, error) {
+	tuples, err := fga.readTuples(ctx, &openfgav1.ReadRequestTupleKey{Object: object})
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := fga.deleteInBatches(ctx, tuples)
+	if err != nil {
+		return deleted, errors.Wrapf(err, "failed to delete tuples of %s", object)
+	}
+	return deleted, nil
+}
+
+// typeDefinitions returns the type definitions of the current authorization model.
+func (fga *OpenFGAServer) typeDefinitions(ctx context.Context) ([]*openfgav1.TypeDefinition, error) {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	r, err := fga.Server.ReadAuthorizationModel(ctx, &openfgav1.ReadAuthorizationModelRequest{
+		StoreId: fga.StoreID,
+		Id:      fga.ActiveModelID(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read authorization model")
+	}
+	return r.GetAuthorizationModel().GetTypeDefinitions(), nil
+}
+
+// DeleteUserTuples deletes every tuple where the user (e.g. "user:alice") is the subject and returns the number
+// of deleted tuples, e.g. for GDPR-style offboarding. OpenFGA can only read tuples by user for a given object
+// type, so every type of the current model is read.
+//
+// Tuples where the user is referenced through one of its own relations, e.g. "group:eng#member" for
+// "group:eng", are deleted as well. Access granted through other objects, like a group the user is a member
+// of, is revoked by deleting the membership tuple, but wildcard tuples (e.g. "user:*") are left untouched and
+// still grant access to a user with the same id.
+func (fga *OpenFGAServer) DeleteUserTuples(ctx context.Context, user string) (int, error) {
+	typeDefinitions, err := fga.typeDefinitions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	users := []string{user}
+	if !tuple.IsObjectRelation(user) {
+		for _, td := range typeDefinitions {
+			if td.GetType() != tuple.GetType(user) {
+				continue
+			}
+			for relation := range td.GetRelations() {
+				users = append(users, tuple.ToObjectRelationString(user, relation))
+			}
+		}
+	}
+
+	var tuples []Tuple
+	for _, td := range typeDefinitions {
+		for _, u := range users {
+			found, err := fga.readTuples(ctx, &openfgav1.ReadRequestTupleKey{Object: td.GetType() + ":", User: u})
+			if err != nil {
+				return 0, err
+			}
+			tuples = append(tuples, found...)
+		}
+	}
+	deleted, err := fga.deleteInBatches(ctx, tuples)
+	if err != nil {
+		return deleted, errors.Wrapf(err, "failed to delete tuples of %s", user)
+	}
+	return deleted, nil
+}
+
+// UserExists reports whether the user (e.g. "user:alice") is the subject of at least one tuple, so that a
+// forged or garbage user cookie can be rejected as unknown instead of being treated as an authenticated user
+// without permissions. A user granted access only through a wildcard (e.g. "user:*") is not found.
+func (fga *OpenFGAServer) UserExists(ctx context.Context, user string) (bool, error) {
+	if user == "" {
+		return false, errors.New("user cannot be empty")
+	}
+	typeDefinitions, err := fga.typeDefinitions(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, td := range typeDefinitions {
+		release, err := fga.limiter.acquire(ctx)
+		if err != nil {
+			return false, err
+		}
+		r, err := fga.Server.Read(ctx, &openfgav1.ReadRequest{
+			StoreId:  fga.StoreID,
+			TupleKey: &openfgav1.ReadRequestTupleKey{Object: td.GetType() + ":", User: user},
+			PageSize: wrapperspb.Int32(1),
+		})
+		release()
+		if err != nil {
+			return false, errors.Wrap(err, "failed to read tuples from OpenFGA")
+		}
+		if len(r.GetTuples()) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ObjectExists reports whether any tuple names the object as its object, e.g. to tell an unknown document from
+// a forbidden one. An object only appearing as the user of tuples, e.g. the group of "group:eng#member", is not
+// known by this lookup.
+func (fga *OpenFGAServer) ObjectExists(ctx context.Context, object string) (bool, error) {
+	if object == "" {
+		return false, errors.New("object cannot be empty")
+	}
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	r, err := fga.Server.Read(ctx, &openfgav1.ReadRequest{
+		StoreId:  fga.StoreID,
+		TupleKey: &openfgav1.ReadRequestTupleKey{Object: object},
+		PageSize: wrapperspb.Int32(1),
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read tuples from OpenFGA")
+	}
+	return len(r.GetTuples()) > 0, nil
+}
+
+// CheckObject is Check with not-found semantics: a denied Check of an object no tuple names fails with
+// ErrObjectNotFound, so the caller can answer 404 instead of 403. The object is only looked up on denial.
+func (fga *OpenFGAServer) CheckObject(ctx context.Context, t Tuple) (bool, error) {
+	allowed, err := fga.Check(ctx, t)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	exists, err := fga.ObjectExists(ctx, t.Object)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, errors.Wrap(ErrObjectNotFound, t.Object)
+	}
+	return false, nil
+}
+
+// listObjectsDeadlineMargin delays the ListObjects deadline of the OpenFGA server past ListObjectsDeadline, so the
+// deadline ListObjects bounds the evaluation context with always hits first and is seen by ListObjects.
+const listObjectsDeadlineMargin = 100 * time.Millisecond
+
+// listObjectsServerDeadline returns the ListObjects deadline of the OpenFGA server for the ListObjectsDeadline, 0
+// leaves the evaluation unbounded.
+func listObjectsServerDeadline(deadline time.Duration) time.Duration {
+	if deadline == 0 {
+		return 0
+	}
+	return deadline + listObjectsDeadlineMargin
+}
+
+// ListObjects returns the objects of the given type the user has the relation with, e.g. "document:1", at most
+// ListObjectsMaxResults of them. When the ListObjectsDeadline is hit, the objects found until then are returned
+// with ErrListObjectsDeadlineExceeded. OpenFGA does not tell a partial result apart, so the evaluation runs with a
+// context bounded by the deadline, which is reported as hit when that context expired by the time the server
+// answers. A false positive remains possible, though rare: an evaluation completing just before the deadline
+// whose response is built after it.
+func (fga *OpenFGAServer) ListObjects(ctx context.Context, objectType, relation, user string) ([]string, error) {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	listCtx := ctx
+	if fga.ListObjectsDeadline > 0 {
+		var cancel context.CancelFunc
+		listCtx, cancel = context.WithTimeout(ctx, fga.ListObjectsDeadline)
+		defer cancel()
+	}
+	r, err := fga.reader().ListObjects(listCtx, &openfgav1.ListObjectsRequest{
+		StoreId:              fga.StoreID,
+		AuthorizationModelId: fga.ActiveModelID(),
+		Type:                 objectType,
+		Relation:             relation,
+		User:                 user,
+	})
+	// the server returns the partial result without an error or any other signal at the deadline, unless the
+	// deadline hit before the evaluation started; the deadline of the caller's context is not ListObjectsDeadline
+	deadlineHit := ctx.Err() == nil && errors.Is(listCtx.Err(), context.DeadlineExceeded)
+	if err != nil {
+		if deadlineHit {
+			return nil, errors.Wrapf(ErrListObjectsDeadlineExceeded, "listed 0 %s objects", objectType)
+		}
+		return nil, errors.Wrap(err, "failed to list objects in OpenFGA")
+	}
+	complete := fga.ListObjectsMaxResults > 0 && len(r.GetObjects()) >= int(fga.ListObjectsMaxResults)
+	if deadlineHit && !complete {
+		return r.GetObjects(), errors.Wrapf(ErrListObjectsDeadlineExceeded, "listed %d %s objects", len(r.GetObjects()), objectType)
+	}
+	return r.GetObjects(), nil
 }
@@ -0,0 +1,1351 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/openfga/openfga/pkg/server"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
+	"github.com/pkg/errors"
+)
+
+const wildcardModel = `model
+  schema 1.1
+
+type user
+type document
+   relations
+		define viewer: [user, user:*] or editor
+		define editor: [user]
+`
+
+// newTestOpenFGA starts an OpenFGA server backed by a temporary sqlite file and the given model.
+func newTestOpenFGA(t *testing.T, model string, tuples []Tuple, opts ...OpenFGAOption) *OpenFGAServer {
+	t.Helper()
+	dir := t.TempDir()
+	fga, err := openTestOpenFGA(filepath.Join(dir, "openfga.db"), writeTestModel(t, dir, model), tuples, opts...)
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	t.Cleanup(func() {
+		_ = fga.Close()
+	})
+	return fga
+}
+
+// writeTestModel writes the model to model.fga in dir and returns its path.
+func writeTestModel(t *testing.T, dir, model string) string {
+	t.Helper()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(model), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	return modelFile
+}
+
+// openTestOpenFGA is newTestOpenFGA on the given datastore URI and model file, it returns the startup error and the
+// caller closes the server.
+func openTestOpenFGA(dataStoreURI, modelFile string, tuples []Tuple, opts ...OpenFGAOption) (*OpenFGAServer, error) {
+	return NewOpenFGA(dataStoreURI, append([]OpenFGAOption{
+		WithInitialTuples(tuples),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	}, opts...)...)
+}
+
+func TestPublicUser(t *testing.T) {
+	if got := PublicUser("user"); got != "user:*" {
+		t.Fatalf("PublicUser(\"user\") = %q, want %q", got, "user:*")
+	}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:public", Relation: "viewer", User: PublicUser("user")},
+	})
+	for _, user := range []string{"user:test@example.com", "user:another@example.com"} {
+		allowed, err := fga.Check(t.Context(), Tuple{Object: "document:public", Relation: "viewer", User: user})
+		if err != nil {
+			t.Fatalf("failed to check tuple: %+v", err)
+		}
+		if !allowed {
+			t.Errorf("expected %s to be allowed to view the public document", user)
+		}
+	}
+}
+
+func TestUserset(t *testing.T) {
+	eng := Userset("group", "eng", "member")
+	if eng != "group:eng#member" {
+		t.Fatalf("Userset(\"group\", \"eng\", \"member\") = %q, want %q", eng, "group:eng#member")
+	}
+	grant := Tuple{Object: "document:1", Relation: "viewer", User: eng}
+	if err := grant.Validate(); err != nil {
+		t.Fatalf("expected the userset tuple to be valid, got %+v", err)
+	}
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "group:eng", Relation: "member", User: "user:test@example.com"},
+		grant,
+	})
+	for user, want := range map[string]bool{"user:test@example.com": true, "user:other@example.com": false} {
+		allowed, err := fga.Check(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: user})
+		if err != nil {
+			t.Fatalf("failed to check tuple: %+v", err)
+		}
+		if allowed != want {
+			t.Errorf("expected %s viewer access through the group membership to be %v, got %v", user, want, allowed)
+		}
+	}
+}
+
+func TestCountTuples(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+		{Object: "document:2", Relation: "viewer", User: "user:another@example.com"},
+	})
+	count, err := fga.CountTuples(t.Context())
+	if err != nil {
+		t.Fatalf("failed to count tuples: %+v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountTuples() = %d, want 2", count)
+	}
+}
+
+func TestSnapshotTuples(t *testing.T) {
+	tuples := []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:anytime@example.com"},
+		{Object: "document:1", Relation: "viewer", User: "user:daytime@example.com", Condition: "business_hours"},
+	}
+	fga := newTestOpenFGA(t, conditionModel, tuples)
+	var many []Tuple
+	for i := range readPageSize + 10 {
+		many = append(many, Tuple{Object: fmt.Sprintf("document:%d", i+2), Relation: "viewer", User: "user:anytime@example.com"})
+	}
+	if err := fga.Write(t.Context(), many, false); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := fga.SnapshotTuples(t.Context())
+	if err != nil {
+		t.Fatalf("failed to snapshot tuples: %+v", err)
+	}
+	got := make(map[string]Tuple, len(snapshot))
+	for _, tpl := range snapshot {
+		got[tpl.String()] = tpl
+	}
+	for _, want := range append(tuples, many...) {
+		if tpl, ok := got[want.String()]; !ok || tpl.Condition != want.Condition {
+			t.Errorf("expected %s with condition %q in the snapshot, got %+v", want, want.Condition, tpl)
+		}
+	}
+	if len(snapshot) != len(tuples)+len(many) {
+		t.Errorf("expected %d tuples in the snapshot, got %d", len(tuples)+len(many), len(snapshot))
+	}
+}
+
+func TestCheckAgainstModel(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	candidate, err := parser.TransformDSLToProto(`model
+  schema 1.1
+
+type user
+type document
+   relations
+		define viewer: [user]
+		define editor: [user]
+`)
+	if err != nil {
+		t.Fatalf("failed to parse the candidate model: %+v", err)
+	}
+	r, err := fga.Server.WriteAuthorizationModel(t.Context(), &openfgav1.WriteAuthorizationModelRequest{
+		StoreId:         fga.StoreID,
+		SchemaVersion:   candidate.GetSchemaVersion(),
+		TypeDefinitions: candidate.GetTypeDefinitions(),
+	})
+	if err != nil {
+		t.Fatalf("failed to write the candidate model: %+v", err)
+	}
+
+	tpl := Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}
+	current, err := fga.Check(t.Context(), tpl)
+	if err != nil {
+		t.Fatalf("failed to check tuple: %+v", err)
+	}
+	shadow, err := fga.CheckAgainstModel(t.Context(), r.GetAuthorizationModelId(), tpl)
+	if err != nil {
+		t.Fatalf("failed to check tuple against the candidate model: %+v", err)
+	}
+	if !current || shadow {
+		t.Errorf("expected the current model to allow and the candidate to deny, got current=%v candidate=%v", current, shadow)
+	}
+}
+
+func TestWithUniqueStoreName(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	if _, err := fga.Server.CreateStore(t.Context(), &openfgav1.CreateStoreRequest{Name: fga.StoreName}); err != nil {
+		t.Fatalf("failed to create a duplicate store: %+v", err)
+	}
+	dataStoreURI := fga.dataStoreURI
+	_ = fga.Close()
+
+	_, err := NewOpenFGA(dataStoreURI,
+		WithInitialTuples(fga.InitialTuples),
+		WithModelFile(fga.ModelFile),
+		WithStoreName(fga.StoreName),
+		WithAuthorizationModelName(fga.AuthorizationModelName),
+		WithUniqueStoreName(true),
+	)
+	if err == nil {
+		t.Fatal("expected an error for duplicated store names")
+	}
+}
+
+func TestConcurrentColdStart(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	dataStoreURI := filepath.Join(dir, "openfga.db")
+	// migrate upfront, the test targets the store creation race and not concurrent migrations
+	if err := Migrate(t.Context(), dataStoreURI); err != nil {
+		t.Fatalf("failed to run migrations: %+v", err)
+	}
+
+	const instances = 2
+	servers := make([]*OpenFGAServer, instances)
+	errs := make([]error, instances)
+	var wg sync.WaitGroup
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			servers[i], errs[i] = NewOpenFGA(dataStoreURI,
+				WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+				WithModelFile(modelFile),
+				WithStoreName("test_store"),
+				WithAuthorizationModelName("default"),
+			)
+		}()
+	}
+	wg.Wait()
+	for i := range instances {
+		if errs[i] != nil {
+			t.Fatalf("failed to create OpenFGA server %d: %+v", i, errs[i])
+		}
+		defer servers[i].Close()
+	}
+
+	if servers[0].StoreID != servers[1].StoreID {
+		t.Errorf("instances bound to different stores: %s and %s", servers[0].StoreID, servers[1].StoreID)
+	}
+	stores, err := servers[0].Server.ListStores(t.Context(), &openfgav1.ListStoresRequest{Name: "test_store"})
+	if err != nil {
+		t.Fatalf("failed to list stores: %+v", err)
+	}
+	if len(stores.GetStores()) != 1 {
+		t.Errorf("expected exactly one store to survive, found %d", len(stores.GetStores()))
+	}
+}
+
+func TestWithAssertionsCheck(t *testing.T) {
+	tuples := []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}
+	for name, tc := range map[string]struct {
+		assertions string
+		wantErr    bool
+	}{
+		"passing": {assertions: `[
+			{"object": "document:1", "relation": "viewer", "user": "user:test@example.com", "expected": true},
+			{"object": "document:1", "relation": "viewer", "user": "user:another@example.com", "expected": false}
+		]`},
+		"failing": {assertions: `[
+			{"object": "document:1", "relation": "viewer", "user": "user:another@example.com", "expected": true}
+		]`, wantErr: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			modelFile := filepath.Join(dir, "model.fga")
+			if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+				t.Fatalf("failed to write the model file: %+v", err)
+			}
+			if err := os.WriteFile(AssertionsFile(modelFile), []byte(tc.assertions), 0o600); err != nil {
+				t.Fatalf("failed to write the assertions file: %+v", err)
+			}
+			fga, err := NewOpenFGA(filepath.Join(dir, "openfga.db"),
+				WithInitialTuples(tuples),
+				WithModelFile(modelFile),
+				WithStoreName("test_store"),
+				WithAuthorizationModelName("default"),
+				WithAssertionsCheck(true),
+			)
+			if err == nil {
+				defer fga.Close()
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("NewOpenFGA() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithSelfTest(t *testing.T) {
+	tuples := []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}
+	fga := newTestOpenFGA(t, wildcardModel, tuples, WithSelfTest([]Expectation{
+		{Tuple: Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}, Expected: true},
+		{Tuple: Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}, Expected: false},
+	}))
+	err := fga.SelfTest(t.Context(), []Expectation{
+		{Tuple: Tuple{Object: "document:1", Relation: "viewer", User: "user:another@example.com"}, Expected: true},
+	})
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 assertions failed") {
+		t.Errorf("expected the self test to fail, got %+v", err)
+	}
+
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	if _, err := NewOpenFGA(filepath.Join(dir, "openfga.db"),
+		WithInitialTuples(tuples),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+		WithSelfTest([]Expectation{{Tuple: Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}, Expected: true}}),
+	); err == nil {
+		t.Error("expected NewOpenFGA to fail on a mismatching expectation")
+	}
+}
+
+func TestStats(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	tpl := Tuple{Object: "document:2", Relation: "viewer", User: "user:test@example.com"}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fga.Check(t.Context(), tpl); err != nil {
+				t.Errorf("failed to check tuple: %+v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := fga.Write(t.Context(), []Tuple{tpl}, false); err != nil {
+		t.Fatalf("failed to write tuple: %+v", err)
+	}
+	if err := fga.Write(t.Context(), []Tuple{{Object: "document:2", Relation: "owner", User: "user:test@example.com"}}, false); err == nil {
+		t.Fatal("expected an error writing a tuple with an undefined relation")
+	}
+	if err := fga.Delete(t.Context(), []Tuple{tpl}); err != nil {
+		t.Fatalf("failed to delete tuple: %+v", err)
+	}
+
+	// the initial tuples account for one write
+	want := Stats{Writes: 3, WriteErrors: 1, Deletes: 1, Checks: 10}
+	if got := fga.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithCacheWarming(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+		{Object: "document:2", Relation: "viewer", User: "user:another@example.com"},
+	}, WithCacheWarming([]Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:test@example.com"},
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}))
+
+	// one configured tuple duplicates a recent change, it is checked once
+	deadline := time.Now().Add(10 * time.Second)
+	for fga.Stats().Checks < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("cache warming issued %d checks, want 3", fga.Stats().Checks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := fga.Close(); err != nil {
+		t.Fatalf("failed to close OpenFGA server: %+v", err)
+	}
+	if checks := fga.Stats().Checks; checks != 3 {
+		t.Errorf("cache warming issued %d checks, want 3", checks)
+	}
+}
+
+func TestDeleteObjectTuples(t *testing.T) {
+	tuples := []Tuple{
+		{Object: "document:2", Relation: "viewer", User: "user:another@example.com"},
+	}
+	for i := range 150 {
+		tuples = append(tuples, Tuple{Object: "document:1", Relation: "viewer", User: fmt.Sprintf("user:%d@example.com", i)})
+	}
+	fga := newTestOpenFGA(t, wildcardModel, tuples)
+
+	deleted, err := fga.DeleteObjectTuples(t.Context(), "document:1")
+	if err != nil {
+		t.Fatalf("failed to delete object tuples: %+v", err)
+	}
+	if deleted != 150 {
+		t.Errorf("DeleteObjectTuples() = %d, want 150", deleted)
+	}
+	if count, err := fga.CountTuples(t.Context()); err != nil || count != 1 {
+		t.Errorf("expected only the tuple of document:2 to remain, got %d, %+v", count, err)
+	}
+}
+
+const groupModel = `model
+  schema 1.1
+
+type user
+type group
+   relations
+		define member: [user]
+type document
+   relations
+		define viewer: [user, group#member] or editor
+		define editor: [user, group#member]
+`
+
+func TestDeleteUserTuples(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+		{Object: "document:2", Relation: "viewer", User: "user:test@example.com"},
+		{Object: "group:eng", Relation: "member", User: "user:test@example.com"},
+		{Object: "group:eng", Relation: "member", User: "user:another@example.com"},
+		{Object: "document:3", Relation: "viewer", User: "group:eng#member"},
+	})
+
+	deleted, err := fga.DeleteUserTuples(t.Context(), "user:test@example.com")
+	if err != nil {
+		t.Fatalf("failed to delete user tuples: %+v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("DeleteUserTuples(user) = %d, want 3", deleted)
+	}
+	if allowed, err := fga.Check(t.Context(), Tuple{Object: "document:3", Relation: "viewer", User: "user:test@example.com"}); err != nil || allowed {
+		t.Errorf("expected the group access to be revoked, got %v, %+v", allowed, err)
+	}
+
+	// the group is referenced as the userset group:eng#member
+	deleted, err = fga.DeleteUserTuples(t.Context(), "group:eng")
+	if err != nil {
+		t.Fatalf("failed to delete user tuples: %+v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteUserTuples(group) = %d, want 1", deleted)
+	}
+	if count, err := fga.CountTuples(t.Context()); err != nil || count != 1 {
+		t.Errorf("expected only the membership of another@example.com to remain, got %d, %+v", count, err)
+	}
+}
+
+func TestWithReadReplicaURI(t *testing.T) {
+	primary := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	_ = primary.Close()
+	// the replica is a snapshot of the primary, it never receives the later writes
+	data, err := os.ReadFile(primary.dataStoreURI)
+	if err != nil {
+		t.Fatalf("failed to read the primary datastore: %+v", err)
+	}
+	replicaURI := filepath.Join(t.TempDir(), "replica.db")
+	if err := os.WriteFile(replicaURI, data, 0o600); err != nil {
+		t.Fatalf("failed to write the replica datastore: %+v", err)
+	}
+
+	fga, err := NewOpenFGA(primary.dataStoreURI,
+		WithInitialTuples(primary.InitialTuples),
+		WithModelFile(primary.ModelFile),
+		WithStoreName(primary.StoreName),
+		WithAuthorizationModelName(primary.AuthorizationModelName),
+		WithReadReplicaURI(replicaURI),
+	)
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	defer fga.Close()
+
+	written := Tuple{Object: "document:2", Relation: "editor", User: "user:test@example.com"}
+	if err := fga.Write(t.Context(), []Tuple{written}, false); err != nil {
+		t.Fatalf("failed to write tuple: %+v", err)
+	}
+	if allowed, err := fga.Check(t.Context(), primary.InitialTuples[0]); err != nil || !allowed {
+		t.Errorf("expected the replicated tuple to be allowed, got %v, %+v", allowed, err)
+	}
+	if allowed, err := fga.Check(t.Context(), written); err != nil || allowed {
+		t.Errorf("expected the unreplicated tuple to be denied on the replica, got %v, %+v", allowed, err)
+	}
+	objects, err := fga.ListObjects(t.Context(), "document", "editor", "user:test@example.com")
+	if err != nil {
+		t.Fatalf("failed to list objects: %+v", err)
+	}
+	if len(objects) != 1 || objects[0] != "document:1" {
+		t.Errorf("ListObjects() = %v, want [document:1]", objects)
+	}
+}
+
+func TestWithModelHotReload(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	fga, err := NewOpenFGA(filepath.Join(dir, "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+		WithModelHotReload(modelFile),
+	)
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	defer fga.Close()
+
+	waitForModelChange := func(previous string) string {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for fga.ActiveModelID() == previous {
+			if time.Now().After(deadline) {
+				t.Fatal("timed out waiting for the model to be reloaded")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return fga.ActiveModelID()
+	}
+
+	initial := fga.ActiveModelID()
+	reloaded := strings.ReplaceAll(wildcardModel, "define viewer: [user, user:*] or editor", "define viewer: [user, user:*]")
+	if err := os.WriteFile(modelFile, []byte(reloaded), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	current := waitForModelChange(initial)
+	if allowed, err := fga.Check(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}); err != nil || allowed {
+		t.Errorf("expected the reloaded model to deny, got %v, %+v", allowed, err)
+	}
+
+	// an invalid model is ignored, a valid one written afterward is picked up again
+	if err := os.WriteFile(modelFile, []byte("model\n  schema 1.1\ntype document\n  relations\n    define viewer: [person]\n"), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	time.Sleep(5 * modelReloadDebounce)
+	if fga.ActiveModelID() != current {
+		t.Fatal("expected the invalid model to be rejected")
+	}
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	waitForModelChange(current)
+}
+
+func TestListObjectsLimits(t *testing.T) {
+	var tuples []Tuple
+	for i := range 5 {
+		tuples = append(tuples, Tuple{Object: fmt.Sprintf("document:%d", i), Relation: "editor", User: "user:test@example.com"})
+	}
+	fga := newTestOpenFGA(t, wildcardModel, tuples, WithListObjectsMaxResults(2))
+	objects, err := fga.ListObjects(t.Context(), "document", "viewer", "user:test@example.com")
+	if err != nil || len(objects) != 2 {
+		t.Errorf("expected 2 objects, got %v, %+v", objects, err)
+	}
+
+	fga = newTestOpenFGA(t, wildcardModel, tuples, WithListObjectsDeadline(time.Nanosecond))
+	if _, err := fga.ListObjects(t.Context(), "document", "viewer", "user:test@example.com"); !errors.Is(err, ErrListObjectsDeadlineExceeded) {
+		t.Errorf("expected ErrListObjectsDeadlineExceeded, got %+v", err)
+	}
+	if err := WithListObjectsDeadline(-time.Second)(fga); err == nil {
+		t.Error("expected an error for a negative deadline")
+	}
+}
+
+func TestWriteSplitsLargeBatches(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	var tuples []Tuple
+	for i := range 250 {
+		tuples = append(tuples, Tuple{Object: "document:2", Relation: "viewer", User: fmt.Sprintf("user:%d@example.com", i)})
+	}
+	before := fga.Stats().Writes
+	if err := fga.Write(t.Context(), tuples, false); err != nil {
+		t.Fatalf("failed to write tuples: %+v", err)
+	}
+	if requests := fga.Stats().Writes - before; requests != 3 {
+		t.Errorf("Write() sent %d requests, want 3", requests)
+	}
+	if count, err := fga.CountTuples(t.Context()); err != nil || count != 251 {
+		t.Errorf("expected 251 tuples, got %d, %+v", count, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	editor := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	viewer := Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{editor})
+
+	if err := fga.Apply(t.Context(), []Tuple{viewer}, []Tuple{editor}); err != nil {
+		t.Fatalf("failed to apply tuples: %+v", err)
+	}
+	if allowed, err := fga.Check(t.Context(), editor); err != nil || allowed {
+		t.Errorf("expected the editor tuple to be deleted, got %v, %+v", allowed, err)
+	}
+	if allowed, err := fga.Check(t.Context(), viewer); err != nil || !allowed {
+		t.Errorf("expected the viewer tuple to be written, got %v, %+v", allowed, err)
+	}
+
+	// deleting a missing tuple fails the whole request, the write is not applied either
+	other := Tuple{Object: "document:2", Relation: "viewer", User: "user:test@example.com"}
+	if err := fga.Apply(t.Context(), []Tuple{other}, []Tuple{editor}); err == nil {
+		t.Fatal("expected an error deleting a missing tuple")
+	}
+	if count, err := fga.CountTuples(t.Context()); err != nil || count != 1 {
+		t.Errorf("expected the failed apply to leave a single tuple, got %d, %+v", count, err)
+	}
+}
+
+func TestWithStoreNamePrefix(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	first := newTestOpenFGA(t, wildcardModel, []Tuple{tpl}, WithStoreNamePrefix("app1/"))
+
+	second, err := NewOpenFGA(first.dataStoreURI,
+		WithInitialTuples([]Tuple{{Object: "document:2", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(first.ModelFile),
+		WithStoreName(first.StoreName),
+		WithAuthorizationModelName(first.AuthorizationModelName),
+		WithStoreNamePrefix("app2/"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create the second OpenFGA server: %+v", err)
+	}
+	defer func() {
+		_ = second.Close()
+	}()
+	if second.StoreID == first.StoreID {
+		t.Fatalf("expected separate stores for the prefixes, both use %s", first.StoreID)
+	}
+	stores, err := second.Server.ListStores(t.Context(), &openfgav1.ListStoresRequest{Name: "app2/" + first.StoreName})
+	if err != nil {
+		t.Fatalf("failed to list stores: %+v", err)
+	}
+	if len(stores.GetStores()) != 1 || stores.GetStores()[0].GetId() != second.StoreID {
+		t.Errorf("expected the prefixed store %s, got %+v", second.StoreID, stores.GetStores())
+	}
+	allowed, err := second.Check(t.Context(), tpl)
+	if err != nil {
+		t.Fatalf("failed to check tuple: %+v", err)
+	}
+	if allowed {
+		t.Errorf("expected the tuple of the first app to be invisible for the second app")
+	}
+}
+
+func TestEmptyModelFile(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte("  \n\t\n"), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	_, err := NewOpenFGA(filepath.Join(dir, "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	)
+	if err == nil || !strings.Contains(err.Error(), "model file is empty: "+modelFile) {
+		t.Fatalf("expected an empty model file error, got %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "openfga.db")); !os.IsNotExist(err) {
+		t.Errorf("expected the datastore not to be created for an empty model, got %+v", err)
+	}
+}
+
+func TestMissingModelFile(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "missing.fga")
+	_, err := openTestOpenFGA(filepath.Join(dir, "openfga.db"), modelFile,
+		[]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}})
+	if err == nil || !strings.Contains(err.Error(), "ModelFile must be an existing file, nothing found at "+modelFile) {
+		t.Fatalf("expected a missing model file error, got %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "openfga.db")); !os.IsNotExist(err) {
+		t.Errorf("expected the datastore not to be created for a missing model file, got %+v", err)
+	}
+}
+
+func TestWithCheckQueryCacheLimit(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	// checkAfterDirectDelete returns the decision of a Check after deleting the checked tuple behind the back of
+	// the server, the changelog is not updated so only an uncached Check sees the deletion
+	checkAfterDirectDelete := func(opts ...OpenFGAOption) bool {
+		fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl}, opts...)
+		if allowed, err := fga.Check(t.Context(), tpl); err != nil || !allowed {
+			t.Fatalf("expected the tuple to be allowed, got %v, %+v", allowed, err)
+		}
+		if _, err := fga.db.Exec("DELETE FROM tuple"); err != nil {
+			t.Fatal(err)
+		}
+		allowed, err := fga.Check(t.Context(), tpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return allowed
+	}
+	if !checkAfterDirectDelete() {
+		t.Error("expected the decision to be served from the check query cache by default")
+	}
+	if checkAfterDirectDelete(WithCheckQueryCacheLimit(0)) {
+		t.Error("expected a check cache limit of 0 to disable the check query cache")
+	}
+}
+
+func TestCacheTTLZero(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl}, WithCacheTTL(0))
+	if allowed, err := fga.Check(t.Context(), tpl); err != nil || !allowed {
+		t.Fatalf("expected the tuple to be allowed, got %v, %+v", allowed, err)
+	}
+
+	// another process sharing the datastore deletes the tuple, the uncached Check sees it at once
+	other, err := NewOpenFGA(fga.dataStoreURI,
+		WithInitialTuples([]Tuple{{Object: "document:2", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(fga.ModelFile),
+		WithStoreName(fga.StoreName),
+		WithAuthorizationModelName("default"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create the other OpenFGA server: %+v", err)
+	}
+	defer other.Close()
+	if err := other.Delete(t.Context(), []Tuple{tpl}); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, err := fga.Check(t.Context(), tpl); err != nil || allowed {
+		t.Errorf("expected the deleted tuple to be denied without caching, got %v, %+v", allowed, err)
+	}
+}
+
+func TestInitialTuplesModelMismatch(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	_, err := NewOpenFGA(filepath.Join(dir, "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "owner", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	)
+	if err == nil || !strings.Contains(err.Error(), "document:1#owner@user:test@example.com") || !strings.Contains(err.Error(), "valid relations: editor, viewer") {
+		t.Fatalf("expected an error naming the bad tuple and the valid relations, got %+v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "openfga.db")); !os.IsNotExist(err) {
+		t.Errorf("expected the datastore not to be created for invalid initial tuples, got %+v", err)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	if got := fga.SchemaVersion(); got != "1.1" {
+		t.Errorf("SchemaVersion() = %q, want %q", got, "1.1")
+	}
+}
+
+func TestNewerDatastoreSchema(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "openfga.db")
+	if err := embeddfga.MigrateTo(t.Context(), "sqlite", dbFile, embeddfga.SqliteSchemaVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	// pretend a newer OpenFGA migrated the datastore further
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", embeddfga.SqliteSchemaVersion+1, true); err != nil {
+		t.Fatal(err)
+	}
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewOpenFGA(dbFile,
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	)
+	if !errors.Is(err, embeddfga.ErrUnsupportedSchemaVersion) {
+		t.Fatalf("expected ErrUnsupportedSchemaVersion, got %+v", err)
+	}
+	if want := fmt.Sprintf("datastore schema v%d, server expects v%d", embeddfga.SqliteSchemaVersion+1, embeddfga.SqliteSchemaVersion); !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the error to contain %q, got %q", want, err)
+	}
+}
+
+func TestEnsureTuples(t *testing.T) {
+	existing := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{existing})
+	tuples := []Tuple{
+		existing,
+		{Object: "document:1", Relation: "viewer", User: "user:alice"},
+		{Object: "document:2", Relation: "viewer", User: PublicUser("user")},
+		{Object: "document:1", Relation: "viewer", User: "user:alice"},
+	}
+	for i := range 2 {
+		if err := fga.EnsureTuples(t.Context(), tuples); err != nil {
+			t.Fatalf("EnsureTuples() run %d failed: %+v", i+1, err)
+		}
+		count, err := fga.CountTuples(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != 3 {
+			t.Errorf("expected 3 tuples after run %d, got %d", i+1, count)
+		}
+	}
+	allowed, err := fga.Check(t.Context(), Tuple{Object: "document:2", Relation: "viewer", User: "user:bob"})
+	if err != nil || !allowed {
+		t.Errorf("expected the public grant to be written, got %v, %+v", allowed, err)
+	}
+}
+
+func TestWithDatastore(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	fga, err := NewOpenFGA("",
+		WithDatastore(memory.New()),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	defer fga.Close()
+	allowed, err := fga.Check(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"})
+	if err != nil || !allowed {
+		t.Errorf("expected the initial tuple to be written to the injected datastore, got %v, %+v", allowed, err)
+	}
+	if err := fga.Backup(t.Context(), filepath.Join(dir, "backup.db")); err == nil {
+		t.Error("expected Backup to fail without the sqlite datastore")
+	}
+
+	if _, err := NewOpenFGA("", WithModelFile(modelFile), WithStoreName("test_store"), WithAuthorizationModelName("default"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}})); err == nil {
+		t.Error("expected an error without a datastore URI nor an injected datastore")
+	}
+}
+
+// flakyDatastore is a datastore failing its readiness checks until failures reaches 0.
+type flakyDatastore struct {
+	storage.OpenFGADatastore
+	failures atomic.Int32
+}
+
+func (ds *flakyDatastore) IsReady(ctx context.Context) (storage.ReadinessStatus, error) {
+	if ds.failures.Add(-1) >= 0 {
+		return storage.ReadinessStatus{}, errors.New("connection refused")
+	}
+	return ds.OpenFGADatastore.IsReady(ctx)
+}
+
+func TestWithAutoMigrate(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	opts := []OpenFGAOption{
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	}
+	dataStoreURI := filepath.Join(dir, "openfga.db")
+	_, err := NewOpenFGA(dataStoreURI, append(opts, WithAutoMigrate(false))...)
+	if !errors.Is(err, embeddfga.ErrMigrationsRequired) {
+		t.Fatalf("expected ErrMigrationsRequired with the automatic migrations disabled, got %+v", err)
+	}
+	if err := Migrate(t.Context(), dataStoreURI); err != nil {
+		t.Fatal(err)
+	}
+	fga, err := NewOpenFGA(dataStoreURI, append(opts, WithAutoMigrate(false))...)
+	if err != nil {
+		t.Fatalf("expected a migrated datastore to start without the automatic migrations, got %+v", err)
+	}
+	_ = fga.Close()
+}
+
+func TestWithDatastoreRetry(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := writeTestModel(t, dir, wildcardModel)
+	open := func(dataStoreURI string, opts ...OpenFGAOption) (*OpenFGAServer, error) {
+		return openTestOpenFGA(dataStoreURI, modelFile,
+			[]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}, opts...)
+	}
+
+	// a datastore becoming ready after 3 attempts
+	ds := &flakyDatastore{OpenFGADatastore: memory.New()}
+	ds.failures.Store(3)
+	fga, err := open("", WithDatastore(ds), WithDatastoreRetry(5, time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	_ = fga.Close()
+	ds = &flakyDatastore{OpenFGADatastore: memory.New()}
+	ds.failures.Store(3)
+	if _, err := open("", WithDatastore(ds), WithDatastoreRetry(2, time.Millisecond)); err == nil {
+		t.Error("expected an error once the retries are exhausted")
+	}
+
+	// the directory of the sqlite file is only created after a few attempts
+	dbDir := filepath.Join(dir, "mounted")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.Mkdir(dbDir, 0o700)
+	}()
+	fga, err = open(filepath.Join(dbDir, "openfga.db"), WithDatastoreRetry(10, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	_ = fga.Close()
+
+	if _, err := open("", WithDatastoreRetry(-1, time.Second)); err == nil {
+		t.Error("expected an error for negative retry attempts")
+	}
+}
+
+// failingCloseDatastore is a datastore failing to close.
+type failingCloseDatastore struct {
+	storage.OpenFGADatastore
+	closed bool
+}
+
+func (ds *failingCloseDatastore) CloseWithError() error {
+	ds.closed = true
+	ds.OpenFGADatastore.Close()
+	return errors.New("failed to flush")
+}
+
+func TestCloseError(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}})
+	if err := fga.Close(); err != nil {
+		t.Errorf("expected no error closing the sqlite datastore, got %+v", err)
+	}
+
+	modelFile := writeTestModel(t, t.TempDir(), wildcardModel)
+	tuples := []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}
+	ds := &failingCloseDatastore{OpenFGADatastore: memory.New()}
+	fga, err := openTestOpenFGA("", modelFile, tuples, WithDatastore(ds))
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	if err := fga.Close(); err == nil || !strings.Contains(err.Error(), "failed to flush") {
+		t.Errorf("expected the close error of the datastore, got %+v", err)
+	}
+	if !ds.closed {
+		t.Error("expected the datastore to be closed")
+	}
+	if err := fga.Close(); err != nil {
+		t.Errorf("expected a second Close to do nothing, got %+v", err)
+	}
+
+	// a startup failing after the datastore is set up closes it
+	ds = &failingCloseDatastore{OpenFGADatastore: memory.New()}
+	_, err = openTestOpenFGA("", modelFile, tuples,
+		WithDatastore(ds),
+		WithSelfTest([]Expectation{{Tuple: Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}, Expected: true}}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "self test") || !strings.Contains(err.Error(), "failed to flush") {
+		t.Errorf("expected the startup error joined with the close error of the datastore, got %+v", err)
+	}
+	if !ds.closed {
+		t.Error("expected the datastore to be closed on a failed startup")
+	}
+}
+
+func TestNewOpenFGAClosesSqliteOnError(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "openfga.db")
+	_, err := openTestOpenFGA(dbFile, writeTestModel(t, dir, wildcardModel),
+		[]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}},
+		WithReadReplicaURI(filepath.Join(dir, "missing", "replica.db")),
+	)
+	if err == nil || !strings.Contains(err.Error(), "read replica") {
+		t.Fatalf("expected an error for an unreachable read replica, got %+v", err)
+	}
+	// sqlite removes the write-ahead log when the last connection of the datastore is closed
+	if _, err := os.Stat(dbFile + "-wal"); !os.IsNotExist(err) {
+		t.Errorf("expected the datastore to be closed, its write-ahead log remains: %+v", err)
+	}
+}
+
+func TestWithLifecycleHook(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := writeTestModel(t, dir, wildcardModel)
+	start := func() []LifecycleEvent {
+		var events []LifecycleEvent
+		fga, err := openTestOpenFGA(filepath.Join(dir, "openfga.db"), modelFile,
+			[]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}},
+			WithLifecycleHook(func(event LifecycleEvent) { events = append(events, event) }),
+		)
+		if err != nil {
+			t.Fatalf("failed to create OpenFGA server: %+v", err)
+		}
+		defer fga.Close()
+		for _, event := range events {
+			if event.Time.IsZero() || event.Duration < 0 {
+				t.Errorf("expected the timing of the %s event, got %+v", event.Type, event)
+			}
+			switch event.Type {
+			case embeddfga.StoreCreated, embeddfga.StoreFound:
+				if event.ID != fga.StoreID {
+					t.Errorf("expected the store ID %s in the %s event, got %s", fga.StoreID, event.Type, event.ID)
+				}
+			case embeddfga.ModelCreated, embeddfga.ModelFound:
+				if event.ID != fga.ActiveModelID() {
+					t.Errorf("expected the model ID %s in the %s event, got %s", fga.ActiveModelID(), event.Type, event.ID)
+				}
+			}
+		}
+		return events
+	}
+	eventTypes := func(events []LifecycleEvent) []embeddfga.LifecycleEventType {
+		types := make([]embeddfga.LifecycleEventType, 0, len(events))
+		for _, event := range events {
+			types = append(types, event.Type)
+		}
+		return types
+	}
+
+	cold := []embeddfga.LifecycleEventType{embeddfga.MigrationsRun, embeddfga.StoreCreated, embeddfga.ModelCreated}
+	if got := eventTypes(start()); !reflect.DeepEqual(got, cold) {
+		t.Errorf("expected the cold start events %v, got %v", cold, got)
+	}
+	warm := []embeddfga.LifecycleEventType{embeddfga.StoreFound, embeddfga.ModelFound}
+	if got := eventTypes(start()); !reflect.DeepEqual(got, warm) {
+		t.Errorf("expected the warm start events %v, got %v", warm, got)
+	}
+}
+
+func TestWithBootstrap(t *testing.T) {
+	var storeID, modelID string
+	bootstrap := func(ctx context.Context, srv *server.Server) (string, string, error) {
+		store, err := srv.CreateStore(ctx, &openfgav1.CreateStoreRequest{Name: "bootstrapped"})
+		if err != nil {
+			return "", "", err
+		}
+		model, err := parser.TransformDSLToProto(wildcardModel)
+		if err != nil {
+			return "", "", err
+		}
+		r, err := srv.WriteAuthorizationModel(ctx, &openfgav1.WriteAuthorizationModelRequest{
+			StoreId:         store.GetId(),
+			SchemaVersion:   model.GetSchemaVersion(),
+			TypeDefinitions: model.GetTypeDefinitions(),
+		})
+		if err != nil {
+			return "", "", err
+		}
+		storeID, modelID = store.GetId(), r.GetAuthorizationModelId()
+		return storeID, modelID, nil
+	}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}, WithBootstrap(bootstrap))
+	if fga.StoreID != storeID || fga.ActiveModelID() != modelID {
+		t.Errorf("expected the bootstrapped store %s and model %s, got %s and %s", storeID, modelID, fga.StoreID, fga.ActiveModelID())
+	}
+	stores, err := fga.Server.ListStores(t.Context(), &openfgav1.ListStoresRequest{Name: "test_store"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stores.GetStores()) != 0 {
+		t.Errorf("expected the default bootstrap not to run, found %d stores named test_store", len(stores.GetStores()))
+	}
+	allowed, err := fga.Check(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"})
+	if err != nil || !allowed {
+		t.Errorf("expected the initial tuples to be written to the bootstrapped store, got %v, %+v", allowed, err)
+	}
+}
+
+func TestWithStoreID(t *testing.T) {
+	const storeID = "01ARZ3NDEKTSV4RRFFQ69G5FAV"
+	dir := t.TempDir()
+	modelFile := writeTestModel(t, dir, wildcardModel)
+	open := func(name string) (*OpenFGAServer, error) {
+		return openTestOpenFGA(filepath.Join(dir, "openfga.db"), modelFile,
+			[]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}},
+			WithStoreName(name),
+			WithStoreID(storeID),
+		)
+	}
+	for range 2 { // created, then found
+		fga, err := open("test_store")
+		if err != nil {
+			t.Fatalf("failed to create OpenFGA server: %+v", err)
+		}
+		if fga.StoreID != storeID {
+			t.Errorf("expected the store ID %s, got %s", storeID, fga.StoreID)
+		}
+		_ = fga.Close()
+	}
+	if _, err := open("other_store"); err == nil {
+		t.Error("expected an error for a store ID of another store")
+	}
+	if _, err := NewOpenFGA(filepath.Join(dir, "openfga.db"), WithStoreID("not-a-ulid")); err == nil {
+		t.Error("expected an error for an invalid store ID")
+	}
+}
+
+func TestWithIDGenerator(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := writeTestModel(t, dir, wildcardModel)
+	ids := []string{"01ARZ3NDEKTSV4RRFFQ69G5FA0", "01ARZ3NDEKTSV4RRFFQ69G5FA1", "01ARZ3NDEKTSV4RRFFQ69G5FA2"}
+	fga, err := openTestOpenFGA(filepath.Join(dir, "openfga.db"), modelFile,
+		[]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}},
+		WithIDGenerator(func() string {
+			id := ids[0]
+			ids = ids[1:]
+			return id
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create OpenFGA server: %+v", err)
+	}
+	defer fga.Close()
+	if fga.StoreID != "01ARZ3NDEKTSV4RRFFQ69G5FA0" || fga.ActiveModelID() != "01ARZ3NDEKTSV4RRFFQ69G5FA1" {
+		t.Errorf("expected the generated IDs, got store %s and model %s", fga.StoreID, fga.ActiveModelID())
+	}
+
+	// a reloaded model gets the next generated ID
+	fga.ModelHotReloadFile = modelFile
+	if err := fga.reloadModel(t.Context()); err != nil {
+		t.Fatalf("failed to reload the model: %+v", err)
+	}
+	if fga.ActiveModelID() != "01ARZ3NDEKTSV4RRFFQ69G5FA2" {
+		t.Errorf("expected the generated model ID, got %s", fga.ActiveModelID())
+	}
+
+	if _, err := NewOpenFGA(filepath.Join(dir, "openfga.db"), WithIDGenerator(nil)); err == nil {
+		t.Error("expected an error for a nil ID generator")
+	}
+}
+
+func TestWithBootstrapError(t *testing.T) {
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.fga")
+	if err := os.WriteFile(modelFile, []byte(wildcardModel), 0o600); err != nil {
+		t.Fatalf("failed to write the model file: %+v", err)
+	}
+	_, err := NewOpenFGA(filepath.Join(dir, "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile(modelFile),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+		WithBootstrap(func(ctx context.Context, srv *server.Server) (string, string, error) {
+			return "", "", errors.New("config service unavailable")
+		}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "config service unavailable") {
+		t.Errorf("expected the bootstrap error, got %+v", err)
+	}
+}
+
+func TestUserExists(t *testing.T) {
+	fga := newTestOpenFGA(t, groupModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+		{Object: "group:eng", Relation: "member", User: "user:another@example.com"},
+	})
+	for user, want := range map[string]bool{
+		"user:test@example.com":    true,
+		"user:another@example.com": true,
+		"user:forged@example.com":  false,
+	} {
+		exists, err := fga.UserExists(t.Context(), user)
+		if err != nil {
+			t.Fatalf("UserExists(%s) failed: %+v", user, err)
+		}
+		if exists != want {
+			t.Errorf("UserExists(%s) = %v, want %v", user, exists, want)
+		}
+	}
+	if _, err := fga.UserExists(t.Context(), ""); err == nil {
+		t.Error("expected an error for an empty user")
+	}
+}
+
+func TestWithConnMaxIdleTime(t *testing.T) {
+	tuples := []Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}
+	byDefault := newTestOpenFGA(t, wildcardModel, tuples)
+	short := newTestOpenFGA(t, wildcardModel, tuples, WithConnMaxIdleTime(100*time.Millisecond))
+	// database/sql closes the idle connections at most once a second
+	time.Sleep(1500 * time.Millisecond)
+	if closed := byDefault.db.Stats().MaxIdleTimeClosed; closed != 0 {
+		t.Errorf("expected no connection to be closed within the default max idle time of 5m, got %d", closed)
+	}
+	if closed := short.db.Stats().MaxIdleTimeClosed; closed == 0 {
+		t.Error("expected the idle connections to be closed after the max idle time of 100ms")
+	}
+}
+
+func TestWithDebugDecisions(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl})
+	buf.Reset()
+	if _, err := fga.Check(t.Context(), tpl); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), `"msg":"check decision"`) {
+		t.Errorf("expected no check decision to be logged by default, got %s", buf.String())
+	}
+
+	fga = newTestOpenFGA(t, wildcardModel, []Tuple{tpl}, WithDebugDecisions(true))
+	buf.Reset()
+	denied := Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}
+	for _, c := range []struct {
+		tuple   Tuple
+		allowed string
+	}{{tpl, `"allowed":true`}, {denied, `"allowed":false`}} {
+		if _, err := fga.Check(t.Context(), c.tuple); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			`"msg":"check decision"`,
+			`"model_id":"` + fga.ActiveModelID() + `"`,
+			`"object":"document:1"`,
+			`"relation":"editor"`,
+			`"user":"` + c.tuple.User + `"`,
+			c.allowed,
+			`"latency":`,
+		} {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("expected the check decision log of %s to contain %s, got %s", c.tuple, want, buf.String())
+			}
+		}
+		buf.Reset()
+	}
+}
+
+func TestWithTraceIDContextKey(t *testing.T) {
+	type traceIDKey struct{}
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl}, WithTraceIDContextKey(traceIDKey{}), WithDebugDecisions(true))
+	buf.Reset()
+	if _, err := fga.Check(context.WithValue(t.Context(), traceIDKey{}, "req-42"), tpl); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"msg":"check decision","trace_id":"req-42"`) {
+		t.Errorf("expected the check decision to be logged with the trace ID, got %s", buf.String())
+	}
+}
+
+func TestWithLogSampling(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	tpl := Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{tpl}, WithLogSampling(3), WithDebugDecisions(true))
+	buf.Reset()
+	for range 7 {
+		if _, err := fga.Check(t.Context(), tpl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Count(buf.String(), `"msg":"check decision"`); got != 3 {
+		t.Errorf("expected 3 of the 7 check decisions to be logged, got %d", got)
+	}
+	if _, err := NewOpenFGA(t.TempDir()+"/openfga.db", WithLogSampling(0)); err == nil {
+		t.Error("expected an error for a log sampling of 0")
+	}
+}
+
+func TestWithWarmup(t *testing.T) {
+	var buf bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}, WithWarmup(true))
+	if !strings.Contains(buf.String(), `"msg":"Warm-up check completed","duration":`) {
+		t.Errorf("expected the warm-up latency to be logged, got %s", buf.String())
+	}
+	if stats := fga.Stats(); stats.Checks != 0 {
+		t.Errorf("expected the warm-up check not to be counted, got %d checks", stats.Checks)
+	}
+}
+
+func TestInitialTuplesWithConditionContext(t *testing.T) {
+	initial := `[{"object": "document:1", "relation": "viewer", "user": "user:guest@example.com",
+		"condition": "temporary_grant", "condition_context": {"valid_until": "2024-01-02T00:00:00Z"}}]`
+	var tuples []Tuple
+	if err := json.Unmarshal([]byte(initial), &tuples); err != nil {
+		t.Fatal(err)
+	}
+	fga := newTestOpenFGA(t, temporaryGrantModel, tuples)
+	guest := Tuple{Object: "document:1", Relation: "viewer", User: "user:guest@example.com"}
+	for currentTime, want := range map[string]bool{
+		"2024-01-01T10:00:00Z": true,
+		"2024-01-03T10:00:00Z": false,
+	} {
+		allowed, err := fga.CheckWithCondition(t.Context(), guest, map[string]any{"current_time": currentTime})
+		if err != nil {
+			t.Fatalf("failed to check: %+v", err)
+		}
+		if allowed != want {
+			t.Errorf("at %s: allowed=%v, want %v", currentTime, allowed, want)
+		}
+	}
+	stored, err := fga.readTuples(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].ConditionContext == nil || stored[0].ConditionContext["valid_until"] != "2024-01-02T00:00:00Z" {
+		t.Errorf("expected the condition context to be read back, got %+v", stored)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the operation counters of an OpenFGAServer. Every request sent to OpenFGA counts as
+// one operation, regardless of the number of tuples it carries.
+type Stats struct {
+	Writes       uint64 `json:"writes"`
+	WriteErrors  uint64 `json:"write_errors"`
+	Deletes      uint64 `json:"deletes"`
+	DeleteErrors uint64 `json:"delete_errors"`
+	Checks       uint64 `json:"checks"`
+	CheckErrors  uint64 `json:"check_errors"`
+	// CheckLatency summarizes the Check durations, it is only set when WithObservedCheckLatency is used.
+	CheckLatency *LatencySummary `json:"check_latency,omitempty"`
+}
+
+// LatencySummary holds the approximate percentiles of the observed latencies. Each percentile is the upper
+// bound of its histogram bucket, so it overestimates the real value by at most ~19%.
+type LatencySummary struct {
+	Count uint64        `json:"count"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+// counters are the atomic operation counters behind Stats.
+type counters struct {
+	writes       atomic.Uint64
+	writeErrors  atomic.Uint64
+	deletes      atomic.Uint64
+	deleteErrors atomic.Uint64
+	checks       atomic.Uint64
+	checkErrors  atomic.Uint64
+}
+
+const (
+	latencyBucketBase       = 10 * time.Microsecond // upper bound of the first bucket
+	latencyBucketsPerOctave = 4                     // bucket bounds grow by 2^(1/4)
+	latencyBuckets          = 84                    // the last bucket (~17s) also collects all slower observations
+)
+
+// latencyHistogram is a lock-free histogram with logarithmic buckets, in the spirit of HDR histograms.
+type latencyHistogram struct {
+	buckets [latencyBuckets]atomic.Uint64
+}
+
+func latencyBucketBound(i int) time.Duration {
+	return time.Duration(float64(latencyBucketBase) * math.Pow(2, float64(i)/latencyBucketsPerOctave))
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	i := 0
+	if d > latencyBucketBase {
+		i = int(math.Ceil(math.Log2(float64(d)/float64(latencyBucketBase)) * latencyBucketsPerOctave))
+	}
+	h.buckets[min(i, latencyBuckets-1)].Add(1)
+}
+
+func (h *latencyHistogram) summary() *LatencySummary {
+	var counts [latencyBuckets]uint64
+	s := &LatencySummary{}
+	for i := range h.buckets {
+		counts[i] = h.buckets[i].Load()
+		s.Count += counts[i]
+	}
+	if s.Count == 0 {
+		return s
+	}
+	quantile := func(q float64) time.Duration {
+		rank := uint64(math.Ceil(q * float64(s.Count)))
+		var seen uint64
+		for i, c := range counts {
+			seen += c
+			if seen >= rank {
+				return latencyBucketBound(i)
+			}
+		}
+		return latencyBucketBound(latencyBuckets - 1)
+	}
+	s.P50, s.P95, s.P99 = quantile(0.50), quantile(0.95), quantile(0.99)
+	return s
+}
+
+// Stats returns a snapshot of the operation counters, it is a lightweight alternative to the OpenFGA metrics.
+func (fga *OpenFGAServer) Stats() Stats {
+	s := Stats{
+		Writes:       fga.stats.writes.Load(),
+		WriteErrors:  fga.stats.writeErrors.Load(),
+		Deletes:      fga.stats.deletes.Load(),
+		DeleteErrors: fga.stats.deleteErrors.Load(),
+		Checks:       fga.stats.checks.Load(),
+		CheckErrors:  fga.stats.checkErrors.Load(),
+	}
+	if fga.checkLatency != nil {
+		s.CheckLatency = fga.checkLatency.summary()
+	}
+	return s
+}
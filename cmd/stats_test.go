@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := &latencyHistogram{}
+	for range 90 {
+		h.observe(time.Millisecond)
+	}
+	for range 9 {
+		h.observe(10 * time.Millisecond)
+	}
+	h.observe(time.Second)
+
+	s := h.summary()
+	if s.Count != 100 {
+		t.Fatalf("Count = %d, want 100", s.Count)
+	}
+	for name, tc := range map[string]struct {
+		got, want time.Duration
+	}{
+		"p50": {s.P50, time.Millisecond},
+		"p95": {s.P95, 10 * time.Millisecond},
+		"p99": {s.P99, 10 * time.Millisecond},
+	} {
+		// the reported value is the bucket upper bound, at most one bucket (2^(1/4)) above the observation
+		if tc.got < tc.want || float64(tc.got) > float64(tc.want)*1.19 {
+			t.Errorf("%s = %s, want ~%s", name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestWithObservedCheckLatency(t *testing.T) {
+	var observed atomic.Int64
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}, WithObservedCheckLatency(func(time.Duration) { observed.Add(1) }))
+
+	for range 5 {
+		if _, err := fga.Check(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}); err != nil {
+			t.Fatalf("failed to check tuple: %+v", err)
+		}
+	}
+	latency := fga.Stats().CheckLatency
+	if latency == nil || latency.Count != 5 {
+		t.Fatalf("expected 5 observed latencies, got %+v", latency)
+	}
+	if latency.P50 > latency.P99 {
+		t.Errorf("p50 %s is greater than p99 %s", latency.P50, latency.P99)
+	}
+	if observed.Load() != 5 {
+		t.Errorf("callback observed %d latencies, want 5", observed.Load())
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// storeMetadataTable is the side table of the sqlite datastore holding the store tags, OpenFGA stores have none.
+const storeMetadataTable = "embedded_openfga_store_metadata"
+
+// WithStoreTags attaches key/value metadata to the store, e.g. the environment, the owner or the app version, to
+// identify the stores accumulating in a shared datastore. The tags are written at every start: a value given
+// again replaces the stored one, the keys not given are kept. They are kept in a side table of the sqlite
+// datastore, so they are not available with an injected datastore. See StoreMetadata.
+func WithStoreTags(tags map[string]string) OpenFGAOption {
+	return func(fga *OpenFGAServer) error {
+		if len(tags) == 0 {
+			return errors.New("store tags cannot be empty")
+		}
+		for key := range tags {
+			if key == "" {
+				return errors.New("store tag key cannot be empty")
+			}
+		}
+		fga.StoreTags = tags
+		return nil
+	}
+}
+
+// writeStoreTags stores the StoreTags of the store, replacing the values of the existing keys.
+func (fga *OpenFGAServer) writeStoreTags(ctx context.Context) error {
+	tx, err := fga.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin store tags transaction")
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+storeMetadataTable+` (
+		store CHAR(26) NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (store, key)
+	)`); err != nil {
+		return errors.Wrap(err, "failed to create store metadata table")
+	}
+	for key, value := range fga.StoreTags {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+storeMetadataTable+` (store, key, value) VALUES (?, ?, ?)
+			ON CONFLICT (store, key) DO UPDATE SET value = excluded.value`, fga.StoreID, key, value); err != nil {
+			return errors.Wrapf(err, "failed to write store tag %q", key)
+		}
+	}
+	return errors.Wrap(tx.Commit(), "failed to commit store tags")
+}
+
+// StoreMetadata returns the tags attached to the store by WithStoreTags, by this or any earlier start, or an
+// empty map if the store has none.
+func (fga *OpenFGAServer) StoreMetadata(ctx context.Context) (map[string]string, error) {
+	if fga.db == nil {
+		return nil, errors.New("store metadata requires the sqlite datastore, not an injected one")
+	}
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	metadata := map[string]string{}
+	var table string
+	err = fga.db.QueryRowContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", storeMetadataTable).Scan(&table)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return metadata, nil // no store of the datastore was ever tagged
+		}
+		return nil, errors.Wrap(err, "failed to look up store metadata table")
+	}
+	rows, err := fga.db.QueryContext(ctx, "SELECT key, value FROM "+storeMetadataTable+" WHERE store = ?", fga.StoreID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read store metadata")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, errors.Wrap(err, "failed to read store metadata")
+		}
+		metadata[key] = value
+	}
+	return metadata, errors.Wrap(rows.Err(), "failed to read store metadata")
+}
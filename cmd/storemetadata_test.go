@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openfga/openfga/pkg/storage/memory"
+)
+
+func TestStoreMetadata(t *testing.T) {
+	fga := newTestOpenFGA(t, wildcardModel, []Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	})
+	if metadata, err := fga.StoreMetadata(t.Context()); err != nil || len(metadata) != 0 {
+		t.Errorf("expected no metadata for an untagged store, got %v, %+v", metadata, err)
+	}
+	if err := fga.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopen the datastore with tags, then with an updated one
+	dbFile := filepath.Join(filepath.Dir(fga.ModelFile), "openfga.db")
+	open := func(tags map[string]string) *OpenFGAServer {
+		t.Helper()
+		reopened, err := NewOpenFGA(dbFile,
+			WithInitialTuples(fga.InitialTuples),
+			WithModelFile(fga.ModelFile),
+			WithStoreName(fga.StoreName),
+			WithAuthorizationModelName(fga.AuthorizationModelName),
+			WithStoreTags(tags),
+		)
+		if err != nil {
+			t.Fatalf("failed to reopen OpenFGA server: %+v", err)
+		}
+		t.Cleanup(func() {
+			_ = reopened.Close()
+		})
+		return reopened
+	}
+	_ = open(map[string]string{"env": "staging", "owner": "team-a"}).Close()
+	tagged := open(map[string]string{"env": "prod"})
+	metadata, err := tagged.StoreMetadata(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"env": "prod", "owner": "team-a"}; !reflect.DeepEqual(metadata, want) {
+		t.Errorf("StoreMetadata() = %v, want %v", metadata, want)
+	}
+}
+
+func TestWithStoreTagsErrors(t *testing.T) {
+	if err := WithStoreTags(map[string]string{"": "value"})(&OpenFGAServer{}); err == nil {
+		t.Error("expected an error for an empty tag key")
+	}
+	_, err := NewOpenFGA("",
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithModelFile("../model.fga"),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+		WithDatastore(memory.New()),
+		WithStoreTags(map[string]string{"env": "test"}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "store tags require the sqlite datastore") {
+		t.Errorf("expected an error for store tags with an injected datastore, got %+v", err)
+	}
+}
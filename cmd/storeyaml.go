@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// storeFile is the store file format of the OpenFGA CLI (fga store import, fga model test) and the playground.
+type storeFile struct {
+	Name   string           `yaml:"name"`
+	Model  string           `yaml:"model"`
+	Tuples []storeFileTuple `yaml:"tuples"`
+	Tests  []storeFileTest  `yaml:"tests,omitempty"`
+}
+
+type storeFileTuple struct {
+	User      string              `yaml:"user"`
+	Relation  string              `yaml:"relation"`
+	Object    string              `yaml:"object"`
+	Condition *storeFileCondition `yaml:"condition,omitempty"`
+}
+
+type storeFileCondition struct {
+	Name    string         `yaml:"name"`
+	Context map[string]any `yaml:"context,omitempty"`
+}
+
+type storeFileTest struct {
+	Name  string           `yaml:"name"`
+	Check []storeFileCheck `yaml:"check"`
+}
+
+// storeFileCheck holds the expected outcomes per relation of a user and object pair.
+type storeFileCheck struct {
+	User       string          `yaml:"user"`
+	Object     string          `yaml:"object"`
+	Assertions map[string]bool `yaml:"assertions"`
+}
+
+// ExportStoreYAML writes the active authorization model, as DSL, and all the tuples of the store to w as an
+// OpenFGA CLI store file, e.g. to inspect the embedded store with the CLI or the playground. The assertions of
+// the model assertions file (see AssertionsFile) are exported as a test when the file exists.
+func (fga *OpenFGAServer) ExportStoreYAML(ctx context.Context, w io.Writer) error {
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	r, err := fga.Server.ReadAuthorizationModel(ctx, &openfgav1.ReadAuthorizationModelRequest{
+		StoreId: fga.StoreID,
+		Id:      fga.ActiveModelID(),
+	})
+	release()
+	if err != nil {
+		return errors.Wrap(err, "failed to read authorization model")
+	}
+	model, err := parser.TransformJSONProtoToDSL(r.GetAuthorizationModel())
+	if err != nil {
+		return errors.Wrap(err, "failed to transform the authorization model to DSL")
+	}
+	keys, err := fga.readTupleKeys(ctx, nil)
+	if err != nil {
+		return err
+	}
+	store := storeFile{
+		Name:   fga.StoreNamePrefix + fga.StoreName,
+		Model:  model,
+		Tuples: make([]storeFileTuple, 0, len(keys)),
+	}
+	for _, k := range keys {
+		t := storeFileTuple{User: k.GetUser(), Relation: k.GetRelation(), Object: k.GetObject()}
+		if c := k.GetCondition(); c != nil {
+			t.Condition = &storeFileCondition{Name: c.GetName(), Context: c.GetContext().AsMap()}
+		}
+		store.Tuples = append(store.Tuples, t)
+	}
+
+	assertionsFile := AssertionsFile(fga.modelPath())
+	if _, err := os.Stat(assertionsFile); err == nil {
+		assertions, err := LoadAssertions(assertionsFile)
+		if err != nil {
+			return err
+		}
+		store.Tests = []storeFileTest{{Name: "assertions", Check: assertionChecks(assertions)}}
+	} else if !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to check assertions file")
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(store); err != nil {
+		return errors.Wrap(err, "failed to write store YAML")
+	}
+	return errors.Wrap(enc.Close(), "failed to write store YAML")
+}
+
+// assertionChecks groups the assertions by user and object, in the order of their first assertion.
+func assertionChecks(assertions []Assertion) []storeFileCheck {
+	var checks []storeFileCheck
+	index := make(map[[2]string]int)
+	for _, a := range assertions {
+		key := [2]string{a.User, a.Object}
+		i, ok := index[key]
+		if !ok {
+			i = len(checks)
+			index[key] = i
+			checks = append(checks, storeFileCheck{User: a.User, Object: a.Object, Assertions: map[string]bool{}})
+		}
+		checks[i].Assertions[a.Relation] = a.Expected
+	}
+	return checks
+}
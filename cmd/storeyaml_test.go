@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportStoreYAML(t *testing.T) {
+	fga := newTestOpenFGA(t, conditionModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:anytime@example.com"},
+		{Object: "document:1", Relation: "viewer", User: "user:daytime@example.com", Condition: "business_hours"},
+	})
+
+	var buf bytes.Buffer
+	if err := fga.ExportStoreYAML(t.Context(), &buf); err != nil {
+		t.Fatalf("failed to export the store: %+v", err)
+	}
+	var store storeFile
+	if err := yaml.Unmarshal(buf.Bytes(), &store); err != nil {
+		t.Fatalf("failed to parse the exported store YAML: %+v\n%s", err, buf.String())
+	}
+	if store.Name != "test_store" {
+		t.Errorf("expected the store name test_store, got %q", store.Name)
+	}
+	if _, err := parser.TransformDSLToProto(store.Model); err != nil {
+		t.Errorf("expected the exported model to be valid DSL, got %+v\n%s", err, store.Model)
+	}
+	if len(store.Tuples) != 2 {
+		t.Fatalf("expected 2 exported tuples, got %+v", store.Tuples)
+	}
+	conditions := 0
+	for _, tpl := range store.Tuples {
+		if tpl.Condition != nil && tpl.Condition.Name == "business_hours" {
+			conditions++
+		}
+	}
+	if conditions != 1 {
+		t.Errorf("expected the condition of the conditioned tuple to be exported, got %+v", store.Tuples)
+	}
+	if len(store.Tests) != 0 {
+		t.Errorf("expected no tests without an assertions file, got %+v", store.Tests)
+	}
+
+	assertions := `[
+		{"object": "document:1", "relation": "viewer", "user": "user:anytime@example.com", "expected": true},
+		{"object": "document:2", "relation": "viewer", "user": "user:anytime@example.com", "expected": false}
+	]`
+	if err := os.WriteFile(AssertionsFile(fga.ModelFile), []byte(assertions), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := fga.ExportStoreYAML(t.Context(), &buf); err != nil {
+		t.Fatalf("failed to export the store: %+v", err)
+	}
+	store = storeFile{}
+	if err := yaml.Unmarshal(buf.Bytes(), &store); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Tests) != 1 || len(store.Tests[0].Check) != 2 || !store.Tests[0].Check[0].Assertions["viewer"] || store.Tests[0].Check[1].Assertions["viewer"] {
+		t.Errorf("expected the assertions to be exported as a test, got %+v", store.Tests)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// TemporaryGrantCondition is the condition of the tuples written by GrantTemporary. The model must define it
+//
+//	condition temporary_grant(current_time: timestamp, valid_until: timestamp) {
+//	  current_time < valid_until
+//	}
+//
+// and allow it on the granted relation, e.g. `define viewer: [user, user with temporary_grant]`.
+const TemporaryGrantCondition = "temporary_grant"
+
+// GrantTemporary writes the tuple with the TemporaryGrantCondition, valid for ttl from now, e.g. to share a
+// document for 24 hours. The expiry is evaluated by OpenFGA on every Check, so no background deletion is
+// involved and a restart cannot turn the grant into a permanent one. The Checks of the relation must pass the
+// request time as the `current_time` condition parameter (see CheckWithCondition and WithConditionContext), a
+// plain Check cannot evaluate the condition. An expired tuple remains in the store until it is deleted.
+//
+// The expiry is stored with a nanosecond precision, so a TTL below a second is honored. Granting a tuple that
+// already exists, e.g. to extend a grant or to make a permanent grant temporary, fails with ErrGrantExists.
+func (fga *OpenFGAServer) GrantTemporary(ctx context.Context, t Tuple, ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("temporary grant TTL must be greater than 0")
+	}
+	if t.Condition != "" && t.Condition != TemporaryGrantCondition {
+		return errors.Errorf("temporary grant cannot carry the condition %q", t.Condition)
+	}
+	t.Condition = TemporaryGrantCondition
+	if err := t.Validate(); err != nil {
+		return errors.Wrap(err, "invalid tuple")
+	}
+	conditionContext, err := structpb.NewStruct(map[string]any{
+		"valid_until": time.Now().Add(ttl).UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return errors.Wrap(err, "invalid condition context")
+	}
+	key := tuple.NewTupleKeyWithCondition(t.Object, t.Relation, t.User, TemporaryGrantCondition, conditionContext)
+	if err := fga.writeTupleKeys(ctx, []*openfgav1.TupleKey{key}, false); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			return errors.Wrapf(ErrGrantExists, "failed to grant %s temporarily: %s", t, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// sweepExpiredGrants deletes the expired temporary grants every interval, until ctx is cancelled.
+func (fga *OpenFGAServer) sweepExpiredGrants(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := fga.deleteExpiredGrants(ctx, time.Now())
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("Failed to sweep the expired temporary grants", slog.Any("err", err))
+				continue
+			}
+			if deleted > 0 {
+				slog.Info("Expired temporary grants deleted", slog.Int("count", deleted))
+			}
+		}
+	}
+}
+
+// deleteExpiredGrants deletes the temporary grants expired at now and returns their number. The store is scanned
+// in pages, the expired grants of each page are deleted before the next page is read.
+func (fga *OpenFGAServer) deleteExpiredGrants(ctx context.Context, now time.Time) (int, error) {
+	deleted := 0
+	continuationToken := ""
+	for {
+		release, err := fga.limiter.acquire(ctx)
+		if err != nil {
+			return deleted, err
+		}
+		r, err := fga.Server.Read(ctx, &openfgav1.ReadRequest{
+			StoreId:           fga.StoreID,
+			PageSize:          wrapperspb.Int32(readPageSize),
+			ContinuationToken: continuationToken,
+		})
+		release()
+		if err != nil {
+			return deleted, errors.Wrap(err, "failed to read tuples from OpenFGA")
+		}
+		var candidates []*openfgav1.TupleKey
+		for _, t := range r.GetTuples() {
+			if grantExpired(t.GetKey(), now) {
+				candidates = append(candidates, t.GetKey())
+			}
+		}
+		if len(candidates) > 0 {
+			n, err := fga.deleteGrantsIfExpired(ctx, candidates, now)
+			deleted += n
+			if err != nil {
+				return deleted, err
+			}
+		}
+		continuationToken = r.GetContinuationToken()
+		if continuationToken == "" {
+			return deleted, nil
+		}
+	}
+}
+
+// deleteGrantsIfExpired deletes the candidate grants that are still expired at now and returns their number. The
+// candidates are read again under the write lock, so a tuple granted again since the scan, e.g. as a permanent
+// grant, is kept. The tuples deleted concurrently by someone else are ignored.
+func (fga *OpenFGAServer) deleteGrantsIfExpired(ctx context.Context, candidates []*openfgav1.TupleKey, now time.Time) (int, error) {
+	unlock, err := fga.lockWrites(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	release, err := fga.limiter.acquire(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	var expired []*openfgav1.TupleKeyWithoutCondition
+	for _, c := range candidates {
+		r, err := fga.Server.Read(ctx, &openfgav1.ReadRequest{
+			StoreId:  fga.StoreID,
+			TupleKey: &openfgav1.ReadRequestTupleKey{Object: c.GetObject(), Relation: c.GetRelation(), User: c.GetUser()},
+		})
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to read tuples from OpenFGA")
+		}
+		for _, t := range r.GetTuples() {
+			if grantExpired(t.GetKey(), now) {
+				expired = append(expired, tuple.TupleKeyToTupleKeyWithoutCondition(t.GetKey()))
+			}
+		}
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+	fga.stats.deletes.Add(1)
+	_, err = fga.Server.Write(ctx, &openfgav1.WriteRequest{
+		StoreId:              fga.StoreID,
+		AuthorizationModelId: fga.ActiveModelID(),
+		Deletes: &openfgav1.WriteRequestDeletes{
+			TupleKeys: expired,
+			OnMissing: "ignore",
+		},
+	})
+	fga.checkCache.invalidate()
+	if err != nil {
+		fga.stats.deleteErrors.Add(1)
+		return 0, errors.Wrap(err, "failed to delete expired temporary grants from OpenFGA")
+	}
+	return len(expired), nil
+}
+
+// grantExpired reports whether the tuple key is a temporary grant expired at now.
+func grantExpired(k *openfgav1.TupleKey, now time.Time) bool {
+	if k.GetCondition().GetName() != TemporaryGrantCondition {
+		return false
+	}
+	validUntil, err := time.Parse(time.RFC3339Nano, k.GetCondition().GetContext().GetFields()["valid_until"].GetStringValue())
+	if err != nil {
+		slog.Debug("Skipping a temporary grant without a valid expiry", slog.Any("tuple", embeddfga.FromTupleKey(k)), slog.Any("err", err))
+		return false
+	}
+	return !now.Before(validUntil)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/pkg/errors"
+)
+
+const temporaryGrantModel = `model
+  schema 1.1
+
+type user
+type document
+   relations
+		define viewer: [user, user with temporary_grant]
+
+condition temporary_grant(current_time: timestamp, valid_until: timestamp) {
+  current_time < valid_until
+}
+`
+
+func TestGrantTemporary(t *testing.T) {
+	fga := newTestOpenFGA(t, temporaryGrantModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:owner@example.com"},
+	})
+	shared := Tuple{Object: "document:1", Relation: "viewer", User: "user:guest@example.com"}
+	if err := fga.GrantTemporary(t.Context(), shared, 24*time.Hour); err != nil {
+		t.Fatalf("failed to grant temporary access: %+v", err)
+	}
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{at: time.Now(), want: true},
+		{at: time.Now().Add(23 * time.Hour), want: true},
+		{at: time.Now().Add(25 * time.Hour), want: false},
+	} {
+		allowed, err := fga.CheckWithCondition(t.Context(), shared, map[string]any{"current_time": tc.at.UTC().Format(time.RFC3339)})
+		if err != nil {
+			t.Fatalf("failed to check: %+v", err)
+		}
+		if allowed != tc.want {
+			t.Errorf("at %s: allowed=%v, want %v", tc.at, allowed, tc.want)
+		}
+	}
+
+	if err := fga.GrantTemporary(t.Context(), shared, time.Hour); !errors.Is(err, ErrGrantExists) {
+		t.Errorf("expected ErrGrantExists granting the tuple again, got %+v", err)
+	}
+	if err := fga.GrantTemporary(t.Context(), shared, 0); err == nil {
+		t.Error("expected an error for a zero TTL")
+	}
+	if err := fga.GrantTemporary(t.Context(), Tuple{Object: "document:2", Relation: "viewer", User: "user:guest@example.com", Condition: "business_hours"}, time.Hour); err == nil {
+		t.Error("expected an error for a tuple with another condition")
+	}
+}
+
+func TestGrantTemporarySubSecond(t *testing.T) {
+	fga := newTestOpenFGA(t, temporaryGrantModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:owner@example.com"},
+	})
+	shared := Tuple{Object: "document:1", Relation: "viewer", User: "user:guest@example.com"}
+	if err := fga.GrantTemporary(t.Context(), shared, 800*time.Millisecond); err != nil {
+		t.Fatalf("failed to grant temporary access: %+v", err)
+	}
+	allowed, err := fga.CheckWithCondition(t.Context(), shared, map[string]any{"current_time": time.Now().UTC().Format(time.RFC3339Nano)})
+	if err != nil {
+		t.Fatalf("failed to check: %+v", err)
+	}
+	if !allowed {
+		t.Error("expected a grant with a sub-second TTL to be valid right after it is written")
+	}
+}
+
+func TestDeleteExpiredGrants(t *testing.T) {
+	fga := newTestOpenFGA(t, temporaryGrantModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:owner@example.com"},
+	})
+	if err := fga.GrantTemporary(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:hour@example.com"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := fga.GrantTemporary(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:day@example.com"}, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := fga.deleteExpiredGrants(t.Context(), time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to delete the expired grants: %+v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 expired grant to be deleted, got %d", deleted)
+	}
+	users := map[string]bool{}
+	tuples, err := fga.readTuples(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tpl := range tuples {
+		users[tpl.User] = true
+	}
+	if len(users) != 2 || !users["user:owner@example.com"] || !users["user:day@example.com"] {
+		t.Errorf("expected the permanent and the unexpired grants to remain, got %+v", tuples)
+	}
+}
+
+func TestDeleteExpiredGrantsPaging(t *testing.T) {
+	fga := newTestOpenFGA(t, temporaryGrantModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:owner@example.com"},
+	})
+	for i := range readPageSize + 10 {
+		if err := fga.GrantTemporary(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: fmt.Sprintf("user:%d@example.com", i)}, time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted, err := fga.deleteExpiredGrants(t.Context(), time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to delete the expired grants: %+v", err)
+	}
+	if deleted != readPageSize+10 {
+		t.Errorf("expected %d expired grants to be deleted, got %d", readPageSize+10, deleted)
+	}
+	if count, err := fga.CountTuples(t.Context()); err != nil || count != 1 {
+		t.Errorf("expected only the permanent tuple to remain, got %d, %v", count, err)
+	}
+}
+
+func TestDeleteExpiredGrantsGrantedAgain(t *testing.T) {
+	fga := newTestOpenFGA(t, temporaryGrantModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:owner@example.com"},
+	})
+	guest := Tuple{Object: "document:1", Relation: "viewer", User: "user:guest@example.com"}
+	if err := fga.GrantTemporary(t.Context(), guest, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	r, err := fga.Server.Read(t.Context(), &openfgav1.ReadRequest{
+		StoreId:  fga.StoreID,
+		TupleKey: &openfgav1.ReadRequestTupleKey{Object: guest.Object, Relation: guest.Relation, User: guest.User},
+	})
+	if err != nil || len(r.GetTuples()) != 1 {
+		t.Fatalf("failed to read the temporary grant: %v, %+v", r.GetTuples(), err)
+	}
+	// the grant is made permanent between the scan of a sweep and its delete
+	if err := fga.Delete(t.Context(), []Tuple{guest}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fga.Write(t.Context(), []Tuple{guest}, false); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := fga.deleteGrantsIfExpired(t.Context(), []*openfgav1.TupleKey{r.GetTuples()[0].GetKey()}, time.Now().Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("failed to delete the expired grants: %+v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("expected the permanent grant to be kept, %d deleted", deleted)
+	}
+	if allowed, err := fga.Check(t.Context(), guest); err != nil || !allowed {
+		t.Errorf("expected the permanent grant to remain, allowed=%v, %v", allowed, err)
+	}
+}
+
+func TestWithExpirySweeper(t *testing.T) {
+	fga := newTestOpenFGA(t, temporaryGrantModel, []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:owner@example.com"},
+	}, WithExpirySweeper(10*time.Millisecond))
+	// a millisecond TTL is expired by the first sweep
+	if err := fga.GrantTemporary(t.Context(), Tuple{Object: "document:1", Relation: "viewer", User: "user:guest@example.com"}, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		count, err := fga.CountTuples(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the sweeper to delete the expired grant, %d tuples remain", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := fga.Close(); err != nil {
+		t.Fatalf("failed to close with a running sweeper: %+v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	entranslations "github.com/go-playground/validator/v10/translations/en"
+	"github.com/pkg/errors"
+)
+
+// configTranslations are the English messages of the validation tags of OpenFGAServer the default translations
+// lack or word poorly, e.g. for a misconfigured MODEL_FILE environment variable.
+var configTranslations = map[string]string{
+	"file":             "{0} must be an existing file, nothing found at {1}",
+	"dir":              "{0} must be an existing directory, nothing found at {1}",
+	"required_without": "{0} is required unless {1} is set",
+}
+
+// configPathMismatchTranslations are the messages of the "file" and "dir" tags when the path exists but is of the
+// other kind, e.g. a directory given as the model file.
+var configPathMismatchTranslations = map[string]string{
+	"file": "{0} must be a file, {1} is a directory",
+	"dir":  "{0} must be a directory, {1} is a file",
+}
+
+// newConfigValidator returns the validator of the OpenFGAServer configuration and its English translator.
+func newConfigValidator() (*validator.Validate, ut.Translator, error) {
+	v := validator.New()
+	trans, _ := ut.New(en.New()).GetTranslator("en")
+	if err := entranslations.RegisterDefaultTranslations(v, trans); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to register the validation messages")
+	}
+	for tag, message := range configTranslations {
+		err := v.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+			if mismatch, ok := configPathMismatchTranslations[tag]; ok {
+				if err := trans.Add(tag+"_mismatch", mismatch, true); err != nil {
+					return err
+				}
+			}
+			return trans.Add(tag, message, true)
+		}, func(trans ut.Translator, fe validator.FieldError) string {
+			key, param := tag, fe.Param()
+			if tag == "file" || tag == "dir" {
+				param = fmt.Sprint(fe.Value())
+				if _, err := os.Stat(param); err == nil {
+					key = tag + "_mismatch"
+				}
+			}
+			msg, err := trans.T(key, fe.Field(), param)
+			if err != nil {
+				return fe.Error()
+			}
+			return msg
+		})
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to register the %q validation message", tag)
+		}
+	}
+	return v, trans, nil
+}
+
+// validateConfig validates the OpenFGAServer configuration and reports every invalid field in a readable message,
+// e.g. "ModelFile must be an existing file, nothing found at /app/model.fga", instead of the raw validator dump.
+func validateConfig(fga *OpenFGAServer) error {
+	v, trans, err := newConfigValidator()
+	if err != nil {
+		return err
+	}
+	err = v.Struct(fga)
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+	messages := make([]string, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		messages = append(messages, fe.Translate(trans))
+	}
+	return errors.Errorf("invalid OpenFGA server configuration: %s", strings.Join(messages, "; "))
+}
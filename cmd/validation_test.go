@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateConfigMessages(t *testing.T) {
+	missingDir := filepath.Join(t.TempDir(), "missing")
+	_, err := NewOpenFGA(filepath.Join(t.TempDir(), "openfga.db"), WithModelDir(missingDir))
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	want := "invalid OpenFGA server configuration: StoreName is a required field; " +
+		"AuthorizationModelName is a required field; InitialTuples must contain at least 1 item; " +
+		"ModelDir must be an existing directory, nothing found at " + missingDir
+	if err.Error() != want {
+		t.Errorf("unexpected validation error\n got: %s\nwant: %s", err, want)
+	}
+
+	_, err = NewOpenFGA(filepath.Join(t.TempDir(), "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+	)
+	if want := "invalid OpenFGA server configuration: ModelFile is required unless ModelDir is set"; err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+
+	dir := t.TempDir()
+	_, err = NewOpenFGA(filepath.Join(t.TempDir(), "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+		WithModelFile(dir),
+	)
+	if want := "invalid OpenFGA server configuration: ModelFile must be a file, " + dir + " is a directory"; err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+
+	file := filepath.Join(t.TempDir(), "model.fga")
+	if err := os.WriteFile(file, []byte("model\n  schema 1.1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewOpenFGA(filepath.Join(t.TempDir(), "openfga.db"),
+		WithInitialTuples([]Tuple{{Object: "document:1", Relation: "editor", User: "user:test@example.com"}}),
+		WithStoreName("test_store"),
+		WithAuthorizationModelName("default"),
+		WithModelDir(file),
+	)
+	if want := "invalid OpenFGA server configuration: ModelDir must be a directory, " + file + " is a file"; err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+}
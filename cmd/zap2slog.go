@@ -6,13 +6,16 @@ import (
 	"os"
 	"time"
 
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
 	"github.com/openfga/openfga/pkg/logger"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type zap2Slog struct {
-	slog slog.Handler
+	slog       slog.Handler
+	traceIDKey any                   // traceIDKey is the context key of the request trace ID added to the records, nil disables it
+	sampler    *embeddfga.LogSampler // sampler drops the repeated debug and info records, nil logs every record
 }
 
 func (s2 zap2Slog) Debug(s string, field ...zap.Field) {
@@ -44,7 +47,9 @@ func (s2 zap2Slog) Fatal(s string, field ...zap.Field) {
 func (s2 zap2Slog) With(field ...zap.Field) logger.Logger {
 	attrs := zapFieldsToAttrs(field)
 	cloned := zap2Slog{
-		slog: s2.slog.WithAttrs(attrs),
+		slog:       s2.slog.WithAttrs(attrs),
+		traceIDKey: s2.traceIDKey,
+		sampler:    s2.sampler,
 	}
 	return &cloned
 }
@@ -85,11 +90,19 @@ func (s2 zap2Slog) log(ctx context.Context, level slog.Level, msg string, fields
 	if !s2.slog.Enabled(ctx, level) {
 		return
 	}
+	if s2.sampler != nil && level < slog.LevelWarn && !s2.sampler.Sample(msg) {
+		return
+	}
 	rec := slog.Record{
 		Time:    time.Now(),
 		Level:   level,
 		Message: msg,
 	}
+	if s2.traceIDKey != nil {
+		if traceID := ctx.Value(s2.traceIDKey); traceID != nil {
+			rec.AddAttrs(slog.Any("trace_id", traceID))
+		}
+	}
 	for _, attr := range zapFieldsToAttrs(fields) {
 		rec.AddAttrs(attr)
 	}
@@ -0,0 +1,357 @@
+package embeddfga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/server"
+	"github.com/openfga/openfga/pkg/server/commands"
+	serverconfig "github.com/openfga/openfga/pkg/server/config"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/typesystem"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrModelTooLarge is returned when the authorization model exceeds the type count limit of the datastore, 100
+// types, or the size limit of the server, 256 KiB by default. The size limit can be raised with
+// WithRawServerOptions(server.WithMaxAuthorizationModelSizeInBytes(n)), together with
+// BootstrapConfig.MaxModelSizeInBytes when the models are written with NewID.
+var ErrModelTooLarge = errors.New("authorization model too large")
+
+// BootstrapConfig describes the store and the authorization model Bootstrap looks up or creates.
+type BootstrapConfig struct {
+	StoreName           string                        // StoreName is the name of the store, required
+	StoreID             string                        // StoreID is the ID of the store, a ULID, it is created with this ID if missing. Empty looks the store up by name
+	Datastore           storage.OpenFGADatastore      // Datastore is the datastore of the server, required with StoreID: the OpenFGA API always generates the ID of a new store
+	UniqueStoreName     bool                          // UniqueStoreName fails the bootstrap if more than one store is named StoreName
+	Model               *openfgav1.AuthorizationModel // Model is written when the store has no authorization model, required
+	NewID               func() string                 // NewID generates the ULIDs of the created store and model instead of OpenFGA's random ones, e.g. for deterministic tests, it requires Datastore
+	MaxModelSizeInBytes int                           // MaxModelSizeInBytes is the model size limit checked with NewID (default is OpenFGA's 256 KiB), set it to the limit of a server raised with server.WithMaxAuthorizationModelSizeInBytes
+	Hook                func(LifecycleEvent)          // Hook receives the StoreCreated, StoreFound, ModelCreated and ModelFound events, optional
+}
+
+// Bootstrap looks up the store and its latest authorization model on the server, creating the store and writing
+// cfg.Model when missing, and returns their IDs. Without a StoreID the oldest store named StoreName is used, see
+// EnsureStore for the concurrent bootstraps. A store found by StoreID must be named StoreName.
+//
+// With NewID, the IDs of the created store and model are generated by the caller, who is responsible for their
+// uniqueness: a colliding store ID fails the bootstrap. Stores and models are ordered by ID, the oldest store and
+// the latest model being the lowest and highest IDs, so the generated IDs must keep increasing like ULIDs do.
+func Bootstrap(ctx context.Context, srv *server.Server, cfg BootstrapConfig) (storeID, modelID string, err error) {
+	if cfg.Model == nil {
+		return "", "", errors.New("authorization model cannot be nil")
+	}
+	storeID, err = EnsureStore(ctx, srv, cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	// lookup the latest authorization model, or write the model if there is none
+	start := time.Now()
+	models, err := srv.ReadAuthorizationModels(ctx, &openfgav1.ReadAuthorizationModelsRequest{
+		StoreId: storeID,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read authorization models: %w", err)
+	}
+	if len(models.GetAuthorizationModels()) > 0 {
+		modelID = models.GetAuthorizationModels()[0].GetId()
+		slog.Debug("Authorization model found", slog.String("model_id", modelID))
+		Emit(cfg.Hook, ModelFound, modelID, start)
+		return storeID, modelID, nil
+	}
+	modelID, err = WriteModel(ctx, srv, storeID, cfg)
+	if err != nil {
+		slog.Error("Failed to write authorization model", slog.Any("err", err))
+		return "", "", fmt.Errorf("failed to write authorization model: %w", err)
+	}
+	slog.Debug("Authorization model created", slog.String("model_id", modelID))
+	Emit(cfg.Hook, ModelCreated, modelID, start)
+	return storeID, modelID, nil
+}
+
+// EnsureStore is the store step of Bootstrap: it returns the ID of the store described by cfg, creating the store
+// if missing, cfg.Model is not used. It is idempotent and safe to call concurrently within a process, the store
+// lookups and creations of the process are serialized.
+//
+// Across processes sharing the datastore, the creation is best effort: a process creating a store re-lists the
+// stores, drops its own if an older one exists and adopts the oldest one. Store IDs are ULIDs, ordered by creation
+// time only to the millisecond and to the clock skew between hosts, so two processes creating their store at the
+// same time can both keep their own. Start a single process first, or set UniqueStoreName to detect a duplicate.
+func EnsureStore(ctx context.Context, srv *server.Server, cfg BootstrapConfig) (string, error) {
+	if cfg.StoreName == "" {
+		return "", errors.New("store name cannot be empty")
+	}
+	if cfg.NewID != nil && cfg.Datastore == nil {
+		return "", errors.New("an ID generator requires the datastore: the OpenFGA API always generates the IDs")
+	}
+	if cfg.StoreID != "" {
+		return ensureStoreID(ctx, srv, cfg)
+	}
+	return lookupStore(ctx, srv, cfg)
+}
+
+// EnsureModel returns the ID of the authorization model of the store identical to cfg.Model, writing cfg.Model as
+// the new latest model if the store has no identical one. Unlike Bootstrap, which keeps the latest model of the
+// store, the models are compared, so a changed model gets written. Processes writing the same model concurrently
+// may both write it, they all return the oldest of the identical models.
+func EnsureModel(ctx context.Context, srv *server.Server, storeID string, cfg BootstrapConfig) (string, error) {
+	if cfg.Model == nil {
+		return "", errors.New("authorization model cannot be nil")
+	}
+	if cfg.NewID != nil && cfg.Datastore == nil {
+		return "", errors.New("an ID generator requires the datastore: the OpenFGA API always generates the IDs")
+	}
+	start := time.Now()
+	modelID, err := findModel(ctx, srv, storeID, cfg.Model)
+	if err != nil {
+		return "", err
+	}
+	if modelID != "" {
+		Emit(cfg.Hook, ModelFound, modelID, start)
+		return modelID, nil
+	}
+	modelID, err = WriteModel(ctx, srv, storeID, cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to write authorization model: %w", err)
+	}
+	slog.Debug("Authorization model created", slog.String("model_id", modelID))
+	// a concurrent process may have written the same model meanwhile, converge on the oldest one
+	if oldestID, err := findModel(ctx, srv, storeID, cfg.Model); err == nil && oldestID != "" && oldestID != modelID {
+		Emit(cfg.Hook, ModelFound, oldestID, start)
+		return oldestID, nil
+	}
+	Emit(cfg.Hook, ModelCreated, modelID, start)
+	return modelID, nil
+}
+
+// findModel returns the ID of the oldest authorization model of the store identical to model, or "" if none.
+func findModel(ctx context.Context, srv *server.Server, storeID string, model *openfgav1.AuthorizationModel) (string, error) {
+	want := &openfgav1.AuthorizationModel{
+		SchemaVersion:   model.GetSchemaVersion(),
+		TypeDefinitions: model.GetTypeDefinitions(),
+		Conditions:      model.GetConditions(),
+	}
+	if want.GetSchemaVersion() == "" {
+		want.SchemaVersion = typesystem.SchemaVersion1_1
+	}
+	found := ""
+	req := &openfgav1.ReadAuthorizationModelsRequest{StoreId: storeID}
+	for {
+		r, err := srv.ReadAuthorizationModels(ctx, req)
+		if err != nil {
+			return "", fmt.Errorf("failed to read authorization models: %w", err)
+		}
+		for _, m := range r.GetAuthorizationModels() {
+			got := &openfgav1.AuthorizationModel{
+				SchemaVersion:   m.GetSchemaVersion(),
+				TypeDefinitions: m.GetTypeDefinitions(),
+				Conditions:      m.GetConditions(),
+			}
+			// the models are listed newest first
+			if proto.Equal(got, want) {
+				found = m.GetId()
+			}
+		}
+		if r.GetContinuationToken() == "" {
+			return found, nil
+		}
+		req.ContinuationToken = r.GetContinuationToken()
+	}
+}
+
+// WriteModel writes cfg.Model as the latest authorization model of the store, with an ID generated by cfg.NewID if
+// set, and returns its ID. A model over the type count limit of the datastore or the size limit of the server fails
+// with ErrModelTooLarge.
+func WriteModel(ctx context.Context, srv *server.Server, storeID string, cfg BootstrapConfig) (string, error) {
+	if cfg.Model == nil {
+		return "", errors.New("authorization model cannot be nil")
+	}
+	if cfg.NewID != nil {
+		if cfg.Datastore == nil {
+			return "", errors.New("an ID generator requires the datastore: the OpenFGA API always generates the IDs")
+		}
+		modelID := cfg.NewID()
+		err := WriteAuthorizationModelWithID(ctx, cfg.Datastore, storeID, modelID, cfg.Model, cfg.MaxModelSizeInBytes)
+		if err != nil {
+			return "", modelTooLargeError(cfg.Model, err)
+		}
+		return modelID, nil
+	}
+	r, err := srv.WriteAuthorizationModel(ctx, &openfgav1.WriteAuthorizationModelRequest{
+		StoreId:         storeID,
+		SchemaVersion:   cfg.Model.GetSchemaVersion(),
+		TypeDefinitions: cfg.Model.GetTypeDefinitions(),
+		Conditions:      cfg.Model.GetConditions(),
+	})
+	if err != nil {
+		return "", modelTooLargeError(cfg.Model, err)
+	}
+	return r.GetAuthorizationModelId(), nil
+}
+
+// modelTooLargeError wraps the two limit errors of the OpenFGA model write, the type count and the size, with
+// ErrModelTooLarge and the measure of the model which hit the limit. The other errors are returned as is.
+func modelTooLargeError(model *openfgav1.AuthorizationModel, err error) error {
+	if status.Code(err) != codes.Code(openfgav1.ErrorCode_exceeded_entity_limit) {
+		return err
+	}
+	msg := status.Convert(err).Message()
+	switch {
+	case strings.Contains(msg, "model exceeds size limit"):
+		// the limit applies to the compiled model, splitting it into modules does not shrink it
+		return fmt.Errorf("%w: the model is %d bytes, over the size limit of the server, remove the types, "+
+			"relations and conditions it does not use: %w", ErrModelTooLarge, proto.Size(model), err)
+	case strings.Contains(msg, "type definitions"):
+		return fmt.Errorf("%w: the model has %d types, over the type count limit of the datastore, remove the "+
+			"types it does not use: %w", ErrModelTooLarge, len(model.GetTypeDefinitions()), err)
+	}
+	return err
+}
+
+// ensureStoreID looks up the store with cfg.StoreID, or creates it in the datastore directly.
+func ensureStoreID(ctx context.Context, srv *server.Server, cfg BootstrapConfig) (string, error) {
+	start := time.Now()
+	store, err := srv.GetStore(ctx, &openfgav1.GetStoreRequest{StoreId: cfg.StoreID})
+	switch {
+	case err == nil:
+		if store.GetName() != cfg.StoreName {
+			return "", fmt.Errorf("store %s is named %q, expected %q", cfg.StoreID, store.GetName(), cfg.StoreName)
+		}
+		slog.Info("Store found", slog.String("id", cfg.StoreID))
+		Emit(cfg.Hook, StoreFound, cfg.StoreID, start)
+	case status.Code(err) == codes.Code(openfgav1.NotFoundErrorCode_store_id_not_found):
+		if cfg.Datastore == nil {
+			return "", fmt.Errorf("store %s does not exist, creating it requires the datastore", cfg.StoreID)
+		}
+		if _, err := cfg.Datastore.CreateStore(ctx, &openfgav1.Store{Id: cfg.StoreID, Name: cfg.StoreName}); err != nil {
+			return "", fmt.Errorf("failed to create store: %w", err)
+		}
+		slog.Debug("Store created", slog.String("id", cfg.StoreID))
+		Emit(cfg.Hook, StoreCreated, cfg.StoreID, start)
+	default:
+		return "", fmt.Errorf("failed to get store: %w", err)
+	}
+	return cfg.StoreID, nil
+}
+
+// lookupStoreMu serializes the store lookups and creations of the process, so that concurrent calls never create
+// two stores with the same name, whatever the order of their IDs.
+var lookupStoreMu sync.Mutex
+
+// lookupStore looks up the oldest store named cfg.StoreName, or creates it.
+func lookupStore(ctx context.Context, srv *server.Server, cfg BootstrapConfig) (storeID string, err error) {
+	lookupStoreMu.Lock()
+	defer lookupStoreMu.Unlock()
+	start := time.Now()
+	stores, err := srv.ListStores(ctx, &openfgav1.ListStoresRequest{Name: cfg.StoreName})
+	if err != nil {
+		return "", fmt.Errorf("failed to list stores: %w", err)
+	}
+	if cfg.UniqueStoreName && len(stores.GetStores()) > 1 {
+		return "", fmt.Errorf("found %d stores with name %q, expected at most one", len(stores.GetStores()), cfg.StoreName)
+	}
+	if len(stores.GetStores()) > 0 {
+		storeID = oldestStoreID(stores.GetStores())
+		slog.Info("Store found", slog.String("id", storeID))
+		Emit(cfg.Hook, StoreFound, storeID, start)
+		return storeID, nil
+	}
+	storeID, err = createStore(ctx, srv, cfg)
+	if err != nil {
+		slog.Error("Failed to create store", slog.Any("err", err))
+		return "", fmt.Errorf("failed to create store: %w", err)
+	}
+	slog.Debug("Store created", slog.String("id", storeID))
+
+	// Another process starting concurrently may have created a store with the same name, converge on the oldest
+	// store and drop the one created here if it lost the race, best effort: see EnsureStore.
+	stores, err = srv.ListStores(ctx, &openfgav1.ListStoresRequest{Name: cfg.StoreName})
+	if err != nil {
+		return "", fmt.Errorf("failed to list stores: %w", err)
+	}
+	if oldestID := oldestStoreID(stores.GetStores()); oldestID != "" && oldestID != storeID {
+		if _, err := srv.DeleteStore(ctx, &openfgav1.DeleteStoreRequest{StoreId: storeID}); err != nil {
+			return "", fmt.Errorf("failed to delete duplicated store: %w", err)
+		}
+		slog.Warn("Store created concurrently, adopting the oldest one",
+			slog.String("id", oldestID), slog.String("deleted_id", storeID))
+		Emit(cfg.Hook, StoreFound, oldestID, start)
+		return oldestID, nil
+	}
+	Emit(cfg.Hook, StoreCreated, storeID, start)
+	return storeID, nil
+}
+
+// createStore creates a store named cfg.StoreName, with an ID generated by cfg.NewID if set.
+func createStore(ctx context.Context, srv *server.Server, cfg BootstrapConfig) (string, error) {
+	if cfg.NewID == nil {
+		cs, err := srv.CreateStore(ctx, &openfgav1.CreateStoreRequest{Name: cfg.StoreName})
+		return cs.GetId(), err
+	}
+	storeID := cfg.NewID()
+	if err := (&openfgav1.GetStoreRequest{StoreId: storeID}).Validate(); err != nil {
+		return "", fmt.Errorf("invalid generated store ID %q: %w", storeID, err)
+	}
+	if _, err := cfg.Datastore.CreateStore(ctx, &openfgav1.Store{Id: storeID, Name: cfg.StoreName}); err != nil {
+		return "", err
+	}
+	return storeID, nil
+}
+
+// WriteAuthorizationModelWithID writes the model to the store with the given model ID, a ULID, through the
+// datastore directly: the OpenFGA API always generates a random ULID. The model is checked like the API does,
+// against the type count limit of the datastore, the maxSizeInBytes limit (0 is OpenFGA's default of 256 KiB,
+// pass the limit the server is configured with) and the typesystem rules. The caller is responsible for the
+// uniqueness of the ID, a colliding ID fails the write. The latest model of a store is the one with the highest
+// ID, so successive IDs must keep increasing like ULIDs do.
+func WriteAuthorizationModelWithID(ctx context.Context, ds storage.OpenFGADatastore, storeID, modelID string, model *openfgav1.AuthorizationModel, maxSizeInBytes int) error {
+	if err := (&openfgav1.ReadAuthorizationModelRequest{StoreId: storeID, Id: modelID}).Validate(); err != nil {
+		return fmt.Errorf("invalid store or model ID: %w", err)
+	}
+	if maxSizeInBytes == 0 {
+		maxSizeInBytes = serverconfig.DefaultMaxAuthorizationModelSizeInBytes
+	}
+	// the command of the API runs the checks, the model ID it generates is replaced on write
+	_, err := commands.NewWriteAuthorizationModelCommand(
+		modelIDWriter{TypeDefinitionWriteBackend: ds, modelID: modelID},
+		commands.WithWriteAuthModelMaxSizeInBytes(maxSizeInBytes),
+	).Execute(ctx, &openfgav1.WriteAuthorizationModelRequest{
+		StoreId:         storeID,
+		SchemaVersion:   model.GetSchemaVersion(),
+		TypeDefinitions: model.GetTypeDefinitions(),
+		Conditions:      model.GetConditions(),
+	})
+	return err
+}
+
+// modelIDWriter writes the models with modelID instead of the ID generated by the WriteAuthorizationModel command,
+// both are ULIDs of the same size.
+type modelIDWriter struct {
+	storage.TypeDefinitionWriteBackend
+	modelID string
+}
+
+func (w modelIDWriter) WriteAuthorizationModel(ctx context.Context, store string, model *openfgav1.AuthorizationModel) error {
+	model.Id = w.modelID
+	return w.TypeDefinitionWriteBackend.WriteAuthorizationModel(ctx, store, model)
+}
+
+// oldestStoreID returns the lowest store ID, store IDs are ULIDs so this is the store created first.
+func oldestStoreID(stores []*openfgav1.Store) string {
+	oldest := ""
+	for _, store := range stores {
+		if oldest == "" || store.GetId() < oldest {
+			oldest = store.GetId()
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,245 @@
+package embeddfga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/openfga/openfga/pkg/server"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const bootstrapModel = `model
+  schema 1.1
+
+type user
+type document
+   relations
+		define viewer: [user]
+`
+
+func TestBootstrap(t *testing.T) {
+	srv, err := NewSqliteServer(t.TempDir() + "/openfga.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	model, err := parser.TransformDSLToProto(bootstrapModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := BootstrapConfig{StoreName: "test_store", Model: model}
+	storeID, modelID, err := Bootstrap(t.Context(), srv, cfg)
+	if err != nil {
+		t.Fatalf("failed to bootstrap: %+v", err)
+	}
+	// the second bootstrap finds the store and the model
+	if s, m, err := Bootstrap(t.Context(), srv, cfg); err != nil || s != storeID || m != modelID {
+		t.Errorf("second Bootstrap() = %s, %s, %+v, want %s, %s", s, m, err, storeID, modelID)
+	}
+
+	// a duplicated store is tolerated, the oldest one is used unless the name must be unique
+	if _, err := srv.CreateStore(t.Context(), &openfgav1.CreateStoreRequest{Name: "test_store"}); err != nil {
+		t.Fatal(err)
+	}
+	if s, _, err := Bootstrap(t.Context(), srv, cfg); err != nil || s != storeID {
+		t.Errorf("expected the oldest store %s, got %s, %+v", storeID, s, err)
+	}
+	cfg.UniqueStoreName = true
+	if _, _, err := Bootstrap(t.Context(), srv, cfg); err == nil || !strings.Contains(err.Error(), "expected at most one") {
+		t.Errorf("expected an error for the duplicated store name, got %+v", err)
+	}
+
+	cfg = BootstrapConfig{StoreName: "other_store", StoreID: "01ARZ3NDEKTSV4RRFFQ69G5FAV", Model: model}
+	if _, _, err := Bootstrap(t.Context(), srv, cfg); err == nil || !strings.Contains(err.Error(), "requires the datastore") {
+		t.Errorf("expected an error creating a store by ID without the datastore, got %+v", err)
+	}
+	cfg.StoreID, cfg.StoreName = storeID, "other_store"
+	if _, _, err := Bootstrap(t.Context(), srv, cfg); err == nil || !strings.Contains(err.Error(), "is named") {
+		t.Errorf("expected an error for the store name mismatch, got %+v", err)
+	}
+}
+
+func TestBootstrapNewID(t *testing.T) {
+	ds := memory.New()
+	srv, err := server.NewServerWithOpts(server.WithDatastore(ds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	model, err := parser.TransformDSLToProto(bootstrapModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{"01ARZ3NDEKTSV4RRFFQ69G5FA0", "01ARZ3NDEKTSV4RRFFQ69G5FA1"}
+	newID := func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+
+	cfg := BootstrapConfig{StoreName: "test_store", Model: model, NewID: newID}
+	if _, _, err := Bootstrap(t.Context(), srv, cfg); err == nil || !strings.Contains(err.Error(), "requires the datastore") {
+		t.Errorf("expected an error for an ID generator without the datastore, got %+v", err)
+	}
+	cfg.Datastore = ds
+	storeID, modelID, err := Bootstrap(t.Context(), srv, cfg)
+	if err != nil {
+		t.Fatalf("failed to bootstrap: %+v", err)
+	}
+	if storeID != "01ARZ3NDEKTSV4RRFFQ69G5FA0" || modelID != "01ARZ3NDEKTSV4RRFFQ69G5FA1" {
+		t.Errorf("Bootstrap() = %s, %s, want the generated IDs", storeID, modelID)
+	}
+	if _, err := srv.ReadAuthorizationModel(t.Context(), &openfgav1.ReadAuthorizationModelRequest{StoreId: storeID, Id: modelID}); err != nil {
+		t.Errorf("failed to read the model with the generated ID: %+v", err)
+	}
+
+	cfg = BootstrapConfig{StoreName: "other_store", Model: model, Datastore: ds, NewID: func() string { return "not-a-ulid" }}
+	if _, _, err := Bootstrap(t.Context(), srv, cfg); err == nil || !strings.Contains(err.Error(), "invalid generated store ID") {
+		t.Errorf("expected an error for an invalid generated ID, got %+v", err)
+	}
+	invalid := &openfgav1.AuthorizationModel{SchemaVersion: "1.1", TypeDefinitions: []*openfgav1.TypeDefinition{{Type: ""}}}
+	if err := WriteAuthorizationModelWithID(t.Context(), ds, storeID, "01ARZ3NDEKTSV4RRFFQ69G5FA2", invalid, 0); err == nil {
+		t.Error("expected an error writing an invalid model")
+	}
+}
+
+// slowCreateDatastore widens the window between the store lookup and the store creation.
+type slowCreateDatastore struct {
+	storage.OpenFGADatastore
+}
+
+func (ds slowCreateDatastore) CreateStore(ctx context.Context, store *openfgav1.Store) (*openfgav1.Store, error) {
+	time.Sleep(10 * time.Millisecond)
+	return ds.OpenFGADatastore.CreateStore(ctx, store)
+}
+
+func TestEnsureStoreConcurrent(t *testing.T) {
+	ds := slowCreateDatastore{memory.New()}
+	srv, err := server.NewServerWithOpts(server.WithDatastore(ds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	// each generated ID is lower than the previous one, a store created later looks older
+	var mu sync.Mutex
+	next := 9
+	newID := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		next--
+		return fmt.Sprintf("01ARZ3NDEKTSV4RRFFQ69G5FA%d", next)
+	}
+	const workers = 8
+	storeIDs, errs := make([]string, workers), make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			storeIDs[i], errs[i] = EnsureStore(t.Context(), srv, BootstrapConfig{StoreName: "test_store", Datastore: ds, NewID: newID})
+		}()
+	}
+	wg.Wait()
+	for i := range workers {
+		if errs[i] != nil || storeIDs[i] != storeIDs[0] {
+			t.Errorf("EnsureStore() = %s, %+v, want %s", storeIDs[i], errs[i], storeIDs[0])
+		}
+	}
+	stores, err := srv.ListStores(t.Context(), &openfgav1.ListStoresRequest{Name: "test_store"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stores.GetStores()) != 1 {
+		t.Errorf("expected a single store, got %d", len(stores.GetStores()))
+	}
+}
+
+func TestWriteAuthorizationModelWithIDLimits(t *testing.T) {
+	ds := memory.New()
+	defer ds.Close()
+	const storeID = "01ARZ3NDEKTSV4RRFFQ69G5FA0"
+	if _, err := ds.CreateStore(t.Context(), &openfgav1.Store{Id: storeID, Name: "test_store"}); err != nil {
+		t.Fatal(err)
+	}
+	tooManyTypes := generatedModel(t, 150, 1)
+	err := WriteAuthorizationModelWithID(t.Context(), ds, storeID, "01ARZ3NDEKTSV4RRFFQ69G5FA1", tooManyTypes, 0)
+	if status.Code(err) != codes.Code(openfgav1.ErrorCode_exceeded_entity_limit) {
+		t.Errorf("expected the type count limit of the datastore to apply, got %+v", err)
+	}
+	tooLarge := generatedModel(t, 20, 800)
+	err = WriteAuthorizationModelWithID(t.Context(), ds, storeID, "01ARZ3NDEKTSV4RRFFQ69G5FA2", tooLarge, 0)
+	if status.Code(err) != codes.Code(openfgav1.ErrorCode_exceeded_entity_limit) {
+		t.Errorf("expected the default size limit to apply, got %+v", err)
+	}
+	if err := WriteAuthorizationModelWithID(t.Context(), ds, storeID, "01ARZ3NDEKTSV4RRFFQ69G5FA3", tooLarge, 4<<20); err != nil {
+		t.Errorf("expected the model to fit a raised size limit, got %+v", err)
+	}
+	if m, err := ds.ReadAuthorizationModel(t.Context(), storeID, "01ARZ3NDEKTSV4RRFFQ69G5FA3"); err != nil || len(m.GetTypeDefinitions()) != 21 {
+		t.Errorf("failed to read the model with the given ID: %+v", err)
+	}
+}
+
+// generatedModel returns a model of the given number of types besides user, with the given number of relations.
+func generatedModel(t *testing.T, types, relations int) *openfgav1.AuthorizationModel {
+	t.Helper()
+	var dsl strings.Builder
+	dsl.WriteString("model\n  schema 1.1\n\ntype user\n")
+	for i := range types {
+		fmt.Fprintf(&dsl, "type resource_%d\n  relations\n", i)
+		for j := range relations {
+			fmt.Fprintf(&dsl, "    define a_rather_long_relation_name_%d: [user]\n", j)
+		}
+	}
+	model, err := parser.TransformDSLToProto(dsl.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model
+}
+
+func TestBootstrapModelTooLarge(t *testing.T) {
+	ds := memory.New()
+	srv, err := server.NewServerWithOpts(server.WithDatastore(ds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ids := []string{"01ARZ3NDEKTSV4RRFFQ69G5FA0", "01ARZ3NDEKTSV4RRFFQ69G5FA1", "01ARZ3NDEKTSV4RRFFQ69G5FA2", "01ARZ3NDEKTSV4RRFFQ69G5FA3"}
+	newID := func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+	for _, tc := range []struct {
+		types, relations int
+		want             string
+	}{
+		{types: 150, relations: 1, want: "the model has 151 types, over the type count limit"},
+		{types: 20, relations: 800, want: "bytes, over the size limit"},
+	} {
+		model := generatedModel(t, tc.types, tc.relations)
+		// through the API, then through the datastore with a given ID
+		for _, cfg := range []BootstrapConfig{
+			{StoreName: fmt.Sprintf("store_%d", tc.types), Model: model},
+			{StoreName: fmt.Sprintf("store_%d_id", tc.types), Model: model, Datastore: ds, NewID: newID},
+		} {
+			_, _, err = Bootstrap(t.Context(), srv, cfg)
+			if !errors.Is(err, ErrModelTooLarge) {
+				t.Fatalf("expected ErrModelTooLarge for %d types, got %+v", tc.types+1, err)
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected the error to mention %q, got %s", tc.want, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package embeddfga
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/openfga/openfga/pkg/storage"
+)
+
+// ErrorClosingDatastore is implemented by the datastores able to report a failure to flush or close, e.g. a
+// datastore buffering its writes. OpenFGADatastore.Close reports nothing, so CloseDatastore calls CloseWithError
+// instead.
+type ErrorClosingDatastore interface {
+	storage.OpenFGADatastore
+	CloseWithError() error
+}
+
+// KeepOpenDatastore keeps the datastore open when the OpenFGA server is closed, the OpenFGA server ignores the
+// errors of the datastore, so the owner closes it afterward with CloseDatastore.
+type KeepOpenDatastore struct {
+	storage.OpenFGADatastore
+}
+
+// Close does not close the datastore, see CloseDatastore.
+func (KeepOpenDatastore) Close() {}
+
+// CloseDatastore closes the datastore and its sqlite connection db, if any, and returns their errors. The sqlite
+// datastore ignores the error of its connection, so the connection is closed first.
+func CloseDatastore(ds storage.OpenFGADatastore, db *sql.DB) error {
+	var errs []error
+	if db != nil {
+		if err := db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the sqlite connection: %w", err))
+		}
+	}
+	if c, ok := ds.(ErrorClosingDatastore); ok {
+		if err := c.CloseWithError(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close the datastore: %w", err))
+		}
+	} else if ds != nil {
+		ds.Close()
+	}
+	return errors.Join(errs...)
+}
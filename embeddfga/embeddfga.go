@@ -2,51 +2,233 @@ package embeddfga
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strings"
 	"time"
 
 	"github.com/openfga/openfga/pkg/server"
 	"github.com/openfga/openfga/pkg/storage"
 	"github.com/openfga/openfga/pkg/storage/migrate"
+	"github.com/openfga/openfga/pkg/storage/mysql"
 	"github.com/openfga/openfga/pkg/storage/sqlcommon"
 	"github.com/openfga/openfga/pkg/storage/sqlite"
 )
 
+const (
+	SqliteSchemaVersion = 5 // SqliteSchemaVersion is the datastore schema version expected for the sqlite engine, its migrations start at 5
+	MySQLSchemaVersion  = 7 // MySQLSchemaVersion is the datastore schema version expected for the mysql engine
+)
+
+// ErrMigrationsRequired is returned by the constructors when the datastore requires migrations and the
+// automatic migrations are disabled with WithAutoMigrate(false).
+var ErrMigrationsRequired = errors.New("datastore requires migrations")
+
+// ErrUnsupportedSchemaVersion is returned by the constructors when the datastore is at a newer schema version than
+// the server expects, e.g. it was migrated by a newer OpenFGA, which the server would misread.
+var ErrUnsupportedSchemaVersion = errors.New("unsupported datastore schema version")
+
+// ServerOption configures the embedded OpenFGA server.
+type ServerOption func(*serverConfig) error
+
+type serverConfig struct {
+	checkCacheLimit uint32
+	autoMigrate     bool
+	traceIDKey      any
+	logSampling     uint64
+	rawOptions      []server.OpenFGAServiceV1Option
+}
+
+// WithRawServerOptions passes OpenFGA server options the package does not wrap, e.g.
+// server.WithListObjectsDeadline. They are applied after the defaults of the package, so they also override them.
+func WithRawServerOptions(opts ...server.OpenFGAServiceV1Option) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.rawOptions = append(cfg.rawOptions, opts...)
+		return nil
+	}
+}
+
+// WithCheckQueryCacheLimit caps the number of entries of the check query cache, the check iterator cache shares
+// the same storage and limit (default is 10000). Once full, the cache evicts the rarely requested entries first
+// (W-TinyLFU), regardless of their TTL. A limit of 0 disables both caches.
+func WithCheckQueryCacheLimit(limit uint32) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.checkCacheLimit = limit
+		return nil
+	}
+}
+
+// WithAutoMigrate enables or disables running the pending migrations when the server is created (default is true).
+// When disabled, the constructors return ErrMigrationsRequired instead, so that the migrations can be run in a
+// separate deployment step with MigrateTo.
+func WithAutoMigrate(autoMigrate bool) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.autoMigrate = autoMigrate
+		return nil
+	}
+}
+
+// WithTraceIDContextKey attaches the value stored under key in the request context, e.g. a request ID set by a
+// middleware, as the "trace_id" attribute of the records the server logs for the request.
+func WithTraceIDContextKey(key any) ServerOption {
+	return func(cfg *serverConfig) error {
+		if key == nil {
+			return fmt.Errorf("trace ID context key cannot be nil")
+		}
+		cfg.traceIDKey = key
+		return nil
+	}
+}
+
+// WithLogSampling logs only the first and then every n-th debug and info record of each message the server logs,
+// warnings and errors are always logged (default is 1, every record is logged). Past 1024 distinct messages, the
+// new ones share a single count, see LogSampler.
+func WithLogSampling(n uint64) ServerOption {
+	return func(cfg *serverConfig) error {
+		if n == 0 {
+			return fmt.Errorf("log sampling must be greater than 0")
+		}
+		cfg.logSampling = n
+		return nil
+	}
+}
+
 func NewSqliteServer(
 	datastoreURI string,
+	opts ...ServerOption,
+) (*server.Server, error) {
+	fgaServer, _, err := newServer(context.Background(), "sqlite", datastoreURI, SqliteSchemaVersion, false, opts)
+	return fgaServer, err
+}
+
+// NewSqliteServerWithCloser is NewSqliteServer for the callers detecting a datastore failing to close, e.g. a
+// write-ahead log not checkpointed. Closing the returned server leaves the datastore open, the server ignores its
+// close errors: closeDatastore closes it and returns them, it must be called once the server is closed.
+func NewSqliteServerWithCloser(
+	datastoreURI string,
+	opts ...ServerOption,
+) (fgaServer *server.Server, closeDatastore func() error, err error) {
+	return newServer(context.Background(), "sqlite", datastoreURI, SqliteSchemaVersion, true, opts)
+}
+
+// NewServerWithDatastore creates an OpenFGA server on the given datastore, e.g. a storage/memory datastore in unit
+// tests, which must be migrated already. Its ownership is transferred: closeDatastore closes it like
+// NewSqliteServerWithCloser, returning the error of an ErrorClosingDatastore, and it is closed on error.
+func NewServerWithDatastore(
+	ds storage.OpenFGADatastore,
+	opts ...ServerOption,
+) (fgaServer *server.Server, closeDatastore func() error, err error) {
+	if ds == nil {
+		return nil, nil, errors.New("datastore cannot be nil")
+	}
+	cfg, err := newServerConfig(opts)
+	if err != nil {
+		return nil, nil, errors.Join(err, CloseDatastore(ds, nil))
+	}
+	fgaServer, err = newServerOnDatastore(KeepOpenDatastore{ds}, cfg)
+	if err != nil {
+		return nil, nil, errors.Join(err, CloseDatastore(ds, nil))
+	}
+	return fgaServer, func() error { return CloseDatastore(ds, nil) }, nil
+}
+
+// NewMySQLServer creates an OpenFGA server backed by a MySQL datastore, e.g.
+// "user:password@tcp(localhost:3306)/openfga?parseTime=true". Missing migrations are applied unless
+// WithAutoMigrate(false) is given.
+func NewMySQLServer(
+	ctx context.Context,
+	datastoreURI string,
+	opts ...ServerOption,
 ) (*server.Server, error) {
-	ds, err := newSqliteStore(context.Background(), datastoreURI, 6)
+	fgaServer, _, err := newServer(ctx, "mysql", datastoreURI, MySQLSchemaVersion, false, opts)
+	return fgaServer, err
+}
+
+// newServer creates the OpenFGA server on a new datastore. With keepOpen, closing the server leaves the datastore
+// open and the returned closeDatastore closes it, otherwise the server closes it and closeDatastore is nil.
+func newServer(
+	ctx context.Context,
+	engine string,
+	datastoreURI string,
+	schemaVersion uint,
+	keepOpen bool,
+	opts []ServerOption,
+) (*server.Server, func() error, error) {
+	cfg, err := newServerConfig(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	ds, db, err := newStore(ctx, engine, datastoreURI, schemaVersion, cfg.autoMigrate)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create datastore: %w", err)
+		return nil, nil, fmt.Errorf("failed to create datastore: %w", err)
+	}
+	var serverDatastore storage.OpenFGADatastore = ds
+	var closeDatastore func() error
+	if keepOpen {
+		serverDatastore = KeepOpenDatastore{ds}
+		closeDatastore = func() error { return CloseDatastore(ds, db) }
+	}
+	fgaServer, err := newServerOnDatastore(serverDatastore, cfg)
+	if err != nil {
+		ds.Close()
+		return nil, nil, err
+	}
+	return fgaServer, closeDatastore, nil
+}
+
+// newServerConfig applies the options to the default configuration.
+func newServerConfig(opts []ServerOption) (serverConfig, error) {
+	cfg := serverConfig{
+		checkCacheLimit: 10000,
+		autoMigrate:     true,
 	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return serverConfig{}, fmt.Errorf("failed to apply server option: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// newServerOnDatastore creates the OpenFGA server on the datastore, it does not close the datastore on error.
+func newServerOnDatastore(ds storage.OpenFGADatastore, cfg serverConfig) (*server.Server, error) {
 	l := zap2Slog{
-		slog: slog.Default().Handler().WithAttrs([]slog.Attr{slog.String("component", "embeddedfga")})}
+		slog:       slog.Default().Handler().WithAttrs([]slog.Attr{slog.String("component", "embeddedfga")}),
+		traceIDKey: cfg.traceIDKey,
+	}
+	if cfg.logSampling > 1 {
+		l.sampler = NewLogSampler(cfg.logSampling)
+	}
 	cacheTTL := time.Minute * 5
-	fgaServer, err := server.NewServerWithOpts(
+	serverOpts := []server.OpenFGAServiceV1Option{
 		server.WithDatastore(ds),
 		server.WithLogger(l),
 		server.WithCacheControllerEnabled(true),
 		server.WithCacheControllerTTL(cacheTTL),
 		server.WithCheckQueryCacheEnabled(true),
 		server.WithCheckQueryCacheTTL(cacheTTL),
+		server.WithCheckCacheLimit(cfg.checkCacheLimit),
 		server.WithCheckIteratorCacheEnabled(true),
 		server.WithMaxChecksPerBatchCheck(5000),
 		server.WithContextPropagationToDatastore(true),
-		server.WithMaxChecksPerBatchCheck(5000),
-	)
+	}
+	fgaServer, err := server.NewServerWithOpts(append(serverOpts, cfg.rawOptions...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize OpenFGA server: %w", err)
 	}
 	return fgaServer, nil
 }
 
-func newSqliteStore(
+// newStore opens the datastore of the given engine and runs the migrations if it requires them and autoMigrate
+// is set. The connection of the sqlite datastore is also returned, closing the datastore closes it too.
+func newStore(
 	ctx context.Context,
+	engine string,
 	datastoreURI string,
 	schemaVersion uint,
-) (storage.OpenFGADatastore, error) {
+	autoMigrate bool,
+) (storage.OpenFGADatastore, *sql.DB, error) {
 	l := zap2Slog{
 		slog: slog.Default().Handler().WithAttrs([]slog.Attr{slog.String("component", "datastore")}),
 	}
@@ -54,43 +236,98 @@ func newSqliteStore(
 	confg := sqlcommon.NewConfig()
 	confg.MaxOpenConns = 10
 	confg.Logger = l
-	ds, err := sqlite.New(
-		datastoreURI,
-		confg,
-	)
+	var ds storage.OpenFGADatastore
+	var db *sql.DB
+	var err error
+	switch engine {
+	case "sqlite":
+		ds, db, err = newSqliteStore(datastoreURI, confg)
+	case "mysql":
+		ds, err = mysql.New(datastoreURI, confg)
+	default:
+		return nil, nil, fmt.Errorf("unsupported datastore engine: %s", engine)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create datastore: %w", err)
+		return nil, nil, fmt.Errorf("failed to create datastore %s: %w", RedactURI(datastoreURI), err)
 	}
 	r, err := ds.IsReady(ctx)
-	if err == nil && r.IsReady {
-		slog.Info("datastore ready")
-		return ds, nil
-	} else if err != nil {
-		return nil, fmt.Errorf("error waiting for datastore to be ready: %w", err)
-	} else if !r.IsReady && strings.Contains(r.Message, "datastore requires migrations") {
-		// 3. Run migration
+	if err != nil {
+		ds.Close()
+		return nil, nil, fmt.Errorf("error waiting for datastore to be ready: %w", err)
+	}
+	if !r.IsReady {
+		// the readiness status only carries a human-readable message, the schema version tells whether
+		// the datastore is not ready because it requires migrations
+		current, err := SchemaVersion(ctx, engine, datastoreURI)
+		if err != nil {
+			ds.Close()
+			return nil, nil, fmt.Errorf("failed to read datastore schema version: %w", err)
+		}
+		if current > schemaVersion {
+			ds.Close()
+			return nil, nil, fmt.Errorf("%w: datastore schema v%d, server expects v%d", ErrUnsupportedSchemaVersion, current, schemaVersion)
+		}
+		if current == schemaVersion {
+			ds.Close()
+			return nil, nil, fmt.Errorf("datastore is not ready: %+v", r)
+		}
+		if !autoMigrate {
+			ds.Close()
+			return nil, nil, fmt.Errorf("%w: schema version is %d, expected %d", ErrMigrationsRequired, current, schemaVersion)
+		}
 		// 3. Run migration
-		slog.Warn("datastore requires migrations, running them now...")
-		err := migrate.RunMigrations(migrate.MigrationConfig{
-			Engine:        "sqlite",
+		slog.Warn("datastore requires migrations, running them now...",
+			slog.String("engine", engine), slog.String("uri", RedactURI(datastoreURI)), slog.Uint64("current", uint64(current)), slog.Uint64("target", uint64(schemaVersion)))
+		err = migrate.RunMigrations(migrate.MigrationConfig{
+			Engine:        engine,
 			URI:           datastoreURI,
 			Verbose:       true,
 			TargetVersion: schemaVersion,
 		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to run migrations: %w", err)
+			ds.Close()
+			return nil, nil, fmt.Errorf("failed to run migrations: %w", err)
 		}
 		slog.Info("datastore migrations completed")
 		r, err = ds.IsReady(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("error waiting for datastore to be ready: %w", err)
+			ds.Close()
+			return nil, nil, fmt.Errorf("error waiting for datastore to be ready: %w", err)
 		}
 		if !r.IsReady {
-			return nil, fmt.Errorf("datastore is not ready: %+v", r)
+			ds.Close()
+			return nil, nil, fmt.Errorf("datastore is not ready: %+v", r)
 		}
-		slog.Info("datastore ready")
-		return ds, nil
-	} else {
-		return nil, fmt.Errorf("datastore is not ready: %+v", r)
 	}
+	// a datastore migrated further by a newer OpenFGA still reports ready
+	current, err := SchemaVersion(ctx, engine, datastoreURI)
+	if err != nil {
+		ds.Close()
+		return nil, nil, fmt.Errorf("failed to read datastore schema version: %w", err)
+	}
+	if current > schemaVersion {
+		ds.Close()
+		return nil, nil, fmt.Errorf("%w: datastore schema v%d, server expects v%d", ErrUnsupportedSchemaVersion, current, schemaVersion)
+	}
+	slog.Info("datastore ready", slog.String("engine", engine), slog.String("uri", RedactURI(datastoreURI)))
+	return ds, db, nil
+}
+
+// newSqliteStore opens the sqlite datastore and its connection the same way as sqlite.New does, which does not
+// return the connection.
+func newSqliteStore(datastoreURI string, confg *sqlcommon.Config) (storage.OpenFGADatastore, *sql.DB, error) {
+	dsn, err := sqlite.PrepareDSN(datastoreURI)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("initialize sqlite connection: %w", err)
+	}
+	ds, err := sqlite.NewWithDB(db, confg)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	return ds, db, nil
 }
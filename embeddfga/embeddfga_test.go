@@ -1,7 +1,17 @@
 package embeddfga
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
 	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/openfga/openfga/pkg/server"
 )
 
 func TestNewSqliteServer(t *testing.T) {
@@ -22,6 +32,51 @@ func TestNewSqliteServer(t *testing.T) {
 	fga2.Close()
 	t.Logf("OpenFGA server closed")
 
+	version, err := SchemaVersion(t.Context(), "sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != SqliteSchemaVersion {
+		t.Errorf("SchemaVersion() = %d, want %d", version, SqliteSchemaVersion)
+	}
+	if version, err := SchemaVersion(t.Context(), "sqlite", "file:"+dbFile+"?_pragma=busy_timeout(100)"); err != nil || version != SqliteSchemaVersion {
+		t.Errorf("SchemaVersion() of the file: URI = %d, %v, want %d", version, err, SqliteSchemaVersion)
+	}
+}
+
+func TestNewSqliteServerWithCloser(t *testing.T) {
+	dbFile := t.TempDir() + "/openfga.db"
+	fga, closeDatastore, err := NewSqliteServerWithCloser(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := fga.CreateStore(t.Context(), &openfgav1.CreateStoreRequest{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fga.Close()
+	if err := closeDatastore(); err != nil {
+		t.Fatalf("closeDatastore() = %v, want nil", err)
+	}
+
+	fga, err = NewSqliteServer(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fga.Close()
+	if _, err := fga.GetStore(t.Context(), &openfgav1.GetStoreRequest{StoreId: store.GetId()}); err != nil {
+		t.Errorf("expected the store to be persisted, got %v", err)
+	}
+}
+
+func TestSchemaVersionMissingFile(t *testing.T) {
+	dbFile := t.TempDir() + "/missing.db"
+	if _, err := SchemaVersion(t.Context(), "sqlite", dbFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a not-found error for a missing datastore, got %v", err)
+	}
+	if _, err := os.Stat(dbFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected SchemaVersion not to create the datastore, got %v", err)
+	}
 }
 
 func TestNewHttpService(t *testing.T) {
@@ -33,3 +88,248 @@ func TestNewHttpService(t *testing.T) {
 	t.Logf("Created new OpenFGA server at %s", dbFile)
 	defer fga1.Close()
 }
+
+func TestNewMySQLServer(t *testing.T) {
+	uri := os.Getenv("EMBEDDFGA_MYSQL_URI")
+	if uri == "" {
+		t.Skip("EMBEDDFGA_MYSQL_URI is not set")
+	}
+	fga, err := NewMySQLServer(t.Context(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Created new OpenFGA server at %s", uri)
+	fga.Close()
+}
+
+func TestMigrationStatus(t *testing.T) {
+	dbFile := t.TempDir() + "/openfga.db"
+	current, target, pending, err := MigrationStatus("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != 0 || target != SqliteSchemaVersion || !pending {
+		t.Errorf("MigrationStatus() before migrations = %d, %d, %v", current, target, pending)
+	}
+
+	fga, err := NewSqliteServer(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fga.Close()
+	current, target, pending, err = MigrationStatus("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != target || pending {
+		t.Errorf("MigrationStatus() after migrations = %d, %d, %v", current, target, pending)
+	}
+}
+
+func TestNewSqliteServerUnmigrated(t *testing.T) {
+	// an initialized but unmigrated datastore, as left by an interrupted first start
+	dbFile := t.TempDir() + "/openfga.db"
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE goose_db_version (id INTEGER PRIMARY KEY, version_id INTEGER, is_applied BOOLEAN, tstamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, true);`); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	fga, err := NewSqliteServer(dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fga.Close()
+	if version, err := SchemaVersion(t.Context(), "sqlite", dbFile); err != nil || version != SqliteSchemaVersion {
+		t.Errorf("SchemaVersion() = %d, %v, want %d", version, err, SqliteSchemaVersion)
+	}
+}
+
+// checkAfterDirectDelete writes a tuple, checks it, deletes it from the datastore behind the back of the server,
+// so the cache controller sees no change, and returns the decision of the second Check: true when the first
+// decision was served from the check query cache.
+func checkAfterDirectDelete(t *testing.T, opts ...ServerOption) bool {
+	t.Helper()
+	dbFile := t.TempDir() + "/openfga.db"
+	s, err := NewSqliteServer(dbFile, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	model, err := parser.TransformDSLToProto(bootstrapModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeID, modelID, err := Bootstrap(t.Context(), s, BootstrapConfig{StoreName: "test_store", Model: model})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := Tuple{Object: "document:1", Relation: "viewer", User: "user:anne"}
+	_, err = s.Write(t.Context(), &openfgav1.WriteRequest{
+		StoreId:              storeID,
+		AuthorizationModelId: modelID,
+		Writes:               &openfgav1.WriteRequestWrites{TupleKeys: []*openfgav1.TupleKey{{Object: tpl.Object, Relation: tpl.Relation, User: tpl.User}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func() bool {
+		r, err := s.Check(t.Context(), &openfgav1.CheckRequest{
+			StoreId:              storeID,
+			AuthorizationModelId: modelID,
+			TupleKey:             &openfgav1.CheckRequestTupleKey{Object: tpl.Object, Relation: tpl.Relation, User: tpl.User},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r.GetAllowed()
+	}
+	if !check() {
+		t.Fatal("expected the written tuple to be allowed")
+	}
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("DELETE FROM tuple"); err != nil {
+		t.Fatal(err)
+	}
+	return check()
+}
+
+func TestWithCheckQueryCacheLimit(t *testing.T) {
+	if !checkAfterDirectDelete(t) {
+		t.Error("expected the decision to be served from the check query cache by default")
+	}
+	if checkAfterDirectDelete(t, WithCheckQueryCacheLimit(0)) {
+		t.Error("expected a check cache limit of 0 to disable the check query cache")
+	}
+}
+
+func TestWithRawServerOptions(t *testing.T) {
+	if checkAfterDirectDelete(t, WithRawServerOptions(server.WithCheckCacheLimit(0))) {
+		t.Error("expected the raw option to override the default check cache limit")
+	}
+
+	s, err := NewSqliteServer(t.TempDir()+"/openfga.db", WithRawServerOptions(server.WithMaxChecksPerBatchCheck(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	model, err := parser.TransformDSLToProto(bootstrapModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storeID, modelID, err := Bootstrap(t.Context(), s, BootstrapConfig{StoreName: "test_store", Model: model})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := make([]*openfgav1.BatchCheckItem, 2)
+	for i := range checks {
+		checks[i] = &openfgav1.BatchCheckItem{
+			TupleKey:      &openfgav1.CheckRequestTupleKey{Object: "document:1", Relation: "viewer", User: "user:anne"},
+			CorrelationId: fmt.Sprint(i),
+		}
+	}
+	_, err = s.BatchCheck(t.Context(), &openfgav1.BatchCheckRequest{StoreId: storeID, AuthorizationModelId: modelID, Checks: checks})
+	if err == nil || !strings.Contains(err.Error(), "the maximum allowed is 1") {
+		t.Errorf("expected the raw option to override the default batch check limit, got %v", err)
+	}
+}
+
+func TestMigrateTo(t *testing.T) {
+	dbFile := t.TempDir() + "/openfga.db"
+	if err := MigrateTo(t.Context(), "sqlite", dbFile, SqliteSchemaVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := SchemaVersion(t.Context(), "sqlite", dbFile); err != nil || v != SqliteSchemaVersion {
+		t.Fatalf("SchemaVersion() after MigrateTo = %d, %v", v, err)
+	}
+	// already at the version
+	if err := MigrateTo(t.Context(), "sqlite", dbFile, SqliteSchemaVersion, false); err != nil {
+		t.Errorf("expected MigrateTo to be a no-op, got %+v", err)
+	}
+	if err := MigrateTo(t.Context(), "sqlite", dbFile, SqliteSchemaVersion+1, false); err == nil {
+		t.Error("expected an error for an unknown version")
+	}
+
+	// pretend a newer OpenFGA migrated the datastore further
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", SqliteSchemaVersion+1, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateTo(t.Context(), "sqlite", dbFile, SqliteSchemaVersion, false); err == nil || !strings.Contains(err.Error(), "refusing to migrate the datastore down") {
+		t.Errorf("expected the downgrade to be refused, got %+v", err)
+	}
+}
+
+func TestMigrateToMySQL(t *testing.T) {
+	uri := os.Getenv("EMBEDDFGA_MYSQL_URI")
+	if uri == "" {
+		t.Skip("EMBEDDFGA_MYSQL_URI is not set")
+	}
+	if err := MigrateTo(t.Context(), "mysql", uri, MySQLSchemaVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateTo(t.Context(), "mysql", uri, MySQLSchemaVersion-1, true); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := SchemaVersion(t.Context(), "mysql", uri); err != nil || v != MySQLSchemaVersion-1 {
+		t.Errorf("SchemaVersion() after the downgrade = %d, %v", v, err)
+	}
+	if err := MigrateTo(t.Context(), "mysql", uri, MySQLSchemaVersion, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithAutoMigrateDisabled(t *testing.T) {
+	dbFile := t.TempDir() + "/openfga.db"
+	_, err := NewSqliteServer(dbFile, WithAutoMigrate(false))
+	if !errors.Is(err, ErrMigrationsRequired) {
+		t.Fatalf("expected ErrMigrationsRequired, got %+v", err)
+	}
+	if version, err := SchemaVersion(t.Context(), "sqlite", dbFile); err != nil || version != 0 {
+		t.Errorf("expected the datastore to be left unmigrated, got version %d, %v", version, err)
+	}
+
+	if err := MigrateTo(t.Context(), "sqlite", dbFile, SqliteSchemaVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	fga, err := NewSqliteServer(dbFile, WithAutoMigrate(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fga.Close()
+}
+
+func TestNewSqliteServerNewerSchema(t *testing.T) {
+	dbFile := t.TempDir() + "/openfga.db"
+	if err := MigrateTo(t.Context(), "sqlite", dbFile, SqliteSchemaVersion, false); err != nil {
+		t.Fatal(err)
+	}
+	// pretend a newer OpenFGA migrated the datastore further
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", SqliteSchemaVersion+1, true); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSqliteServer(dbFile)
+	if !errors.Is(err, ErrUnsupportedSchemaVersion) {
+		t.Fatalf("expected ErrUnsupportedSchemaVersion, got %+v", err)
+	}
+	if want := fmt.Sprintf("datastore schema v%d, server expects v%d", SqliteSchemaVersion+1, SqliteSchemaVersion); !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the error to contain %q, got %q", want, err)
+	}
+}
@@ -0,0 +1,22 @@
+package embeddfga
+
+import (
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/tuple"
+)
+
+// FromFGATuple converts an OpenFGA tuple, e.g. of the fgaclient code written against tuple.Tuple, to a Tuple,
+// including its condition, if any.
+func FromFGATuple(t *tuple.Tuple) Tuple {
+	return FromTupleKey((*openfgav1.TupleKey)(t))
+}
+
+// ToFGATuple converts the Tuple to an OpenFGA tuple. Unlike FromFGATuple it can fail: the ConditionContext is
+// converted to a protobuf Struct, see TupleKey.
+func (t Tuple) ToFGATuple() (*tuple.Tuple, error) {
+	tk, err := t.TupleKey()
+	if err != nil {
+		return nil, err
+	}
+	return tuple.From(tk), nil
+}
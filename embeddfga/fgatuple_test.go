@@ -0,0 +1,31 @@
+package embeddfga
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+func TestFGATupleConversion(t *testing.T) {
+	for _, tpl := range []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "group:admins#member"},
+		{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "business_hours"},
+	} {
+		fgaTuple, err := tpl.ToFGATuple()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tk := (*openfgav1.TupleKey)(fgaTuple); tk.GetObject() != tpl.Object || tk.GetRelation() != tpl.Relation ||
+			tk.GetUser() != tpl.User || tk.GetCondition().GetName() != tpl.Condition {
+			t.Errorf("ToFGATuple() = %+v, want %+v", fgaTuple, tpl)
+		}
+		if got := FromFGATuple(fgaTuple); got.ID() != tpl.ID() || got.Condition != tpl.Condition || got.ConditionContext != nil {
+			t.Errorf("FromFGATuple(ToFGATuple()) = %+v, want %+v", got, tpl)
+		}
+	}
+	invalid := Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "temporary_grant",
+		ConditionContext: map[string]any{"valid_until": make(chan int)}}
+	if _, err := invalid.ToFGATuple(); err == nil {
+		t.Error("expected an error for a condition context which cannot be converted")
+	}
+}
@@ -0,0 +1,32 @@
+package embeddfga
+
+import "time"
+
+// LifecycleEventType is the kind of bootstrap step a LifecycleEvent reports.
+type LifecycleEventType string
+
+const (
+	StoreCreated  LifecycleEventType = "store_created"  // StoreCreated is emitted when the store is created
+	StoreFound    LifecycleEventType = "store_found"    // StoreFound is emitted when an existing store is used
+	ModelCreated  LifecycleEventType = "model_created"  // ModelCreated is emitted when the authorization model is written
+	ModelFound    LifecycleEventType = "model_found"    // ModelFound is emitted when an existing authorization model is used
+	MigrationsRun LifecycleEventType = "migrations_run" // MigrationsRun is emitted when the pending datastore migrations were run
+)
+
+// LifecycleEvent reports a completed bootstrap step, e.g. to feed the bootstrap telemetry instead of parsing logs.
+type LifecycleEvent struct {
+	Type     LifecycleEventType // Type is the completed step
+	ID       string             // ID is the ID of the store or of the authorization model, empty for MigrationsRun
+	Time     time.Time          // Time is the time the step completed
+	Duration time.Duration      // Duration is the time the step took
+}
+
+// Emit sends the event of the step started at start to the hook, if any, e.g. for the steps run by the caller such
+// as the migrations.
+func Emit(hook func(LifecycleEvent), eventType LifecycleEventType, id string, start time.Time) {
+	if hook == nil {
+		return
+	}
+	now := time.Now()
+	hook(LifecycleEvent{Type: eventType, ID: id, Time: now, Duration: now.Sub(start)})
+}
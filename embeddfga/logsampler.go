@@ -0,0 +1,39 @@
+package embeddfga
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// logSamplerMaxMessages bounds the number of messages counted separately by a LogSampler, the messages seen once
+// it is reached share a single count, e.g. messages embedding variable text.
+const logSamplerMaxMessages = 1024
+
+// LogSampler logs the first and then every n-th record of each message, see WithLogSampling. It is safe for
+// concurrent use, the loggers cloned with With share it so that the counts cover all of them.
+type LogSampler struct {
+	n        uint64
+	counts   sync.Map // message -> *atomic.Uint64
+	messages atomic.Int64
+	overflow atomic.Uint64 // overflow counts the messages beyond logSamplerMaxMessages
+}
+
+// NewLogSampler returns a LogSampler logging 1 in n records of each message.
+func NewLogSampler(n uint64) *LogSampler {
+	return &LogSampler{n: n}
+}
+
+// Sample tells whether the record with the message is logged.
+func (ls *LogSampler) Sample(msg string) bool {
+	c, ok := ls.counts.Load(msg)
+	if !ok {
+		if ls.messages.Load() >= logSamplerMaxMessages {
+			return (ls.overflow.Add(1)-1)%ls.n == 0
+		}
+		var loaded bool
+		if c, loaded = ls.counts.LoadOrStore(msg, new(atomic.Uint64)); !loaded {
+			ls.messages.Add(1)
+		}
+	}
+	return (c.(*atomic.Uint64).Add(1)-1)%ls.n == 0
+}
@@ -0,0 +1,32 @@
+package embeddfga
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLogSampler(t *testing.T) {
+	ls := NewLogSampler(3)
+	var logged []bool
+	for range 4 {
+		logged = append(logged, ls.Sample("check decision"))
+	}
+	if want := []bool{true, false, false, true}; fmt.Sprint(logged) != fmt.Sprint(want) {
+		t.Errorf("Sample() = %v, want %v", logged, want)
+	}
+	if !ls.Sample("another message") {
+		t.Error("expected the first record of another message to be logged")
+	}
+
+	// messages with variable text share a single count beyond the bound
+	ls = NewLogSampler(2)
+	for i := range logSamplerMaxMessages + 100 {
+		ls.Sample(fmt.Sprintf("request %d failed", i))
+	}
+	if got := ls.messages.Load(); got != logSamplerMaxMessages {
+		t.Errorf("expected %d counted messages, got %d", logSamplerMaxMessages, got)
+	}
+	if got := ls.overflow.Load(); got != 100 {
+		t.Errorf("expected the 100 messages beyond the bound to share a count, got %d", got)
+	}
+}
@@ -0,0 +1,77 @@
+package embeddfga
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/openfga/openfga/pkg/typesystem"
+)
+
+// ValidateTuplesAgainstModel checks each tuple is well-formed (see Tuple.Validate) and can be written in the
+// model: the relation is defined for the object type and the user is one of its directly related user types,
+// with the tuple's condition. The error names the first bad tuple and the valid relations or user types.
+func ValidateTuplesAgainstModel(model *openfgav1.AuthorizationModel, tuples []Tuple) error {
+	ts, err := typesystem.New(model)
+	if err != nil {
+		return fmt.Errorf("invalid authorization model: %w", err)
+	}
+	for _, t := range tuples {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("tuple %s: %w", t, err)
+		}
+		objectType := tuple.GetType(t.Object)
+		relations, err := ts.GetRelations(objectType)
+		if err != nil {
+			return fmt.Errorf("tuple %s: type %q is not defined in the model", t, objectType)
+		}
+		relation, ok := relations[t.Relation]
+		if !ok {
+			return fmt.Errorf("tuple %s: relation %q is not defined for type %q, valid relations: %s",
+				t, t.Relation, objectType, strings.Join(slices.Sorted(maps.Keys(relations)), ", "))
+		}
+		userRef := userReference(t.User)
+		var allowed []string
+		assignable := false
+		for _, restriction := range relation.GetTypeInfo().GetDirectlyRelatedUserTypes() {
+			if typesystem.RelationEquals(userRef, restriction) && restriction.GetCondition() == t.Condition {
+				assignable = true
+				break
+			}
+			allowed = append(allowed, relationReferenceString(restriction))
+		}
+		if !assignable {
+			return fmt.Errorf("tuple %s: user %q cannot be assigned to relation %q of type %q, allowed user types: [%s]",
+				t, t.User, t.Relation, objectType, strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+// userReference returns the type reference of the user of a tuple, e.g. "user", "user:*" or "group#member".
+func userReference(user string) *openfgav1.RelationReference {
+	userObject, userRelation := tuple.SplitObjectRelation(user)
+	userType := tuple.GetType(userObject)
+	if tuple.IsTypedWildcard(user) {
+		return typesystem.WildcardRelationReference(userType)
+	}
+	return typesystem.DirectRelationReference(userType, userRelation)
+}
+
+// relationReferenceString formats a type restriction in the DSL notation, e.g. "user with business_hours".
+func relationReferenceString(ref *openfgav1.RelationReference) string {
+	s := ref.GetType()
+	switch {
+	case ref.GetWildcard() != nil:
+		s += ":*"
+	case ref.GetRelation() != "":
+		s += "#" + ref.GetRelation()
+	}
+	if ref.GetCondition() != "" {
+		s += " with " + ref.GetCondition()
+	}
+	return s
+}
@@ -0,0 +1,58 @@
+package embeddfga
+
+import (
+	"strings"
+	"testing"
+
+	parser "github.com/openfga/language/pkg/go/transformer"
+)
+
+const validationModel = `model
+  schema 1.1
+
+type user
+type group
+   relations
+		define member: [user]
+type document
+   relations
+		define viewer: [user, user:*, group#member, user with business_hours] or editor
+		define editor: [user]
+
+condition business_hours(current_time: timestamp) {
+  current_time.getHours() >= 9 && current_time.getHours() < 17
+}
+`
+
+func TestValidateTuplesAgainstModel(t *testing.T) {
+	model, err := parser.TransformDSLToProto(validationModel)
+	if err != nil {
+		t.Fatalf("failed to transform DSL to OpenFGA model: %+v", err)
+	}
+	valid := []Tuple{
+		{Object: "document:1", Relation: "viewer", User: "user:anne"},
+		{Object: "document:1", Relation: "viewer", User: "user:*"},
+		{Object: "document:1", Relation: "viewer", User: "group:eng#member"},
+		{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "business_hours"},
+		{Object: "group:eng", Relation: "member", User: "user:anne"},
+	}
+	if err := ValidateTuplesAgainstModel(model, valid); err != nil {
+		t.Fatalf("expected the tuples to be valid, got %+v", err)
+	}
+	for _, tc := range []struct {
+		tuple Tuple
+		want  string
+	}{
+		{Tuple{Object: "document:1", Relation: "owner", User: "user:anne"}, "valid relations: editor, viewer"},
+		{Tuple{Object: "folder:1", Relation: "viewer", User: "user:anne"}, `type "folder" is not defined`},
+		{Tuple{Object: "document:1", Relation: "editor", User: "group:eng#member"}, "allowed user types: [user]"},
+		{Tuple{Object: "document:1", Relation: "editor", User: "user:anne", Condition: "business_hours"}, "allowed user types: [user]"},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "group:eng"}, "group#member"},
+		{Tuple{Object: "document", Relation: "viewer", User: "user:anne"}, "invalid object"},
+	} {
+		err := ValidateTuplesAgainstModel(model, append(append([]Tuple{}, valid...), tc.tuple))
+		if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), tc.tuple.String()) {
+			t.Errorf("expected an error naming %s and containing %q, got %v", tc.tuple, tc.want, err)
+		}
+	}
+}
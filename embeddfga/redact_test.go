@@ -0,0 +1,19 @@
+package embeddfga
+
+import "testing"
+
+func TestRedactURI(t *testing.T) {
+	for uri, want := range map[string]string{
+		"postgres://openfga:secret@db:5432/openfga?sslmode=disable": "postgres://openfga:xxxxx@db:5432/openfga?sslmode=disable",
+		"openfga:secret@tcp(db:3306)/openfga?parseTime=true":        "openfga:xxxxx@tcp(db:3306)/openfga?parseTime=true",
+		"openfga:s3cr@t/x@tcp(db:3306)/openfga":                     "openfga:xxxxx@tcp(db:3306)/openfga",
+		"openfga@tcp(db:3306)/openfga":                              "openfga@tcp(db:3306)/openfga",
+		"openfga:secret@/openfga":                                   "openfga:xxxxx@/openfga",
+		"/var/lib/openfga/openfga.db":                               "/var/lib/openfga/openfga.db",
+		"file:/home/a@b/openfga.db?_pragma=busy_timeout(100)":       "file:/home/a@b/openfga.db?_pragma=busy_timeout(100)",
+	} {
+		if got := RedactURI(uri); got != want {
+			t.Errorf("RedactURI(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
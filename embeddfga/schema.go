@@ -0,0 +1,184 @@
+package embeddfga
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openfga/openfga/assets"
+	"github.com/openfga/openfga/pkg/storage/migrate"
+)
+
+// SchemaVersion returns the migration version the datastore is at, read from the goose_db_version table,
+// or 0 if it has never been migrated. Unlike the migration runner it never modifies the datastore: a sqlite
+// file is opened read-only and a missing one is reported with an error wrapping fs.ErrNotExist.
+func SchemaVersion(ctx context.Context, engine, datastoreURI string) (uint, error) {
+	var driver, dsn, tableQuery string
+	switch engine {
+	case "sqlite":
+		// the DSN is not prepared on purpose, setting the WAL journal mode would modify the file
+		driver = "sqlite"
+		dsn = datastoreURI
+		if path := sqlitePath(datastoreURI); path != ":memory:" {
+			if _, err := os.Stat(path); err != nil {
+				return 0, fmt.Errorf("failed to open datastore: %w", err)
+			}
+			// only a file: URI is opened read-only, mode=ro is ignored for a plain path
+			dsn = "file:" + path + "?mode=ro"
+		}
+		tableQuery = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'goose_db_version'"
+	case "mysql":
+		driver = "mysql"
+		dsn = datastoreURI
+		tableQuery = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'goose_db_version'"
+	default:
+		return 0, fmt.Errorf("unsupported datastore engine: %s", engine)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open datastore: %w", err)
+	}
+	defer db.Close()
+
+	var tables int
+	if err := db.QueryRowContext(ctx, tableQuery).Scan(&tables); err != nil {
+		return 0, fmt.Errorf("failed to look up the migrations table: %w", err)
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+
+	// the same resolution as goose: the latest applied version that has not been rolled back since
+	rows, err := db.QueryContext(ctx, "SELECT version_id, is_applied FROM goose_db_version ORDER BY id DESC")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the migrations table: %w", err)
+	}
+	defer rows.Close()
+	rolledBack := map[int64]bool{}
+	for rows.Next() {
+		var version int64
+		var applied bool
+		if err := rows.Scan(&version, &applied); err != nil {
+			return 0, fmt.Errorf("failed to read the migrations table: %w", err)
+		}
+		if rolledBack[version] {
+			continue
+		}
+		if applied {
+			return uint(version), nil
+		}
+		rolledBack[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read the migrations table: %w", err)
+	}
+	return 0, nil
+}
+
+// sqlitePath returns the file path of a sqlite datastore URI, without the file: scheme and the query parameters.
+func sqlitePath(datastoreURI string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(datastoreURI, "file:"), "?")
+	return path
+}
+
+// LatestSchemaVersion returns the version of the latest migration embedded in OpenFGA for the engine.
+func LatestSchemaVersion(engine string) (uint, error) {
+	versions, err := schemaVersions(engine)
+	if err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	return versions[len(versions)-1], nil
+}
+
+// schemaVersions returns the sorted versions of the migrations embedded in OpenFGA for the engine.
+func schemaVersions(engine string) ([]uint, error) {
+	var dir string
+	switch engine {
+	case "sqlite":
+		dir = assets.SqliteMigrationDir
+	case "mysql":
+		dir = assets.MySQLMigrationDir
+	default:
+		return nil, fmt.Errorf("unsupported datastore engine: %s", engine)
+	}
+	entries, err := fs.ReadDir(assets.EmbedMigrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the embedded migrations: %w", err)
+	}
+	var versions []uint
+	for _, entry := range entries {
+		// migration files are named <version>_<description>.sql
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, uint(version))
+	}
+	slices.Sort(versions)
+	return versions, nil
+}
+
+// MigrateTo migrates the datastore to the given schema version, one of the embedded migrations. It is a no-op
+// when the datastore is already at that version. Migrating down to an older version reverts migrations and may
+// lose data, it is refused unless allowDown is set. A missing sqlite file is created and migrated.
+func MigrateTo(ctx context.Context, engine, uri string, version uint, allowDown bool) error {
+	versions, err := schemaVersions(engine)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(versions, version) {
+		return fmt.Errorf("unknown schema version %d for engine %s, available versions: %v", version, engine, versions)
+	}
+	current, err := SchemaVersion(ctx, engine, uri)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read datastore schema version: %w", err)
+	}
+	if current == version {
+		return nil
+	}
+	if version < current && !allowDown {
+		return fmt.Errorf("refusing to migrate the datastore down from version %d to %d", current, version)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	slog.Warn("migrating datastore",
+		slog.String("engine", engine), slog.String("uri", RedactURI(uri)), slog.Uint64("current", uint64(current)), slog.Uint64("target", uint64(version)))
+	err = migrate.RunMigrations(migrate.MigrationConfig{
+		Engine:        engine,
+		URI:           uri,
+		Verbose:       true,
+		TargetVersion: version,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+	slog.Info("datastore migrations completed", slog.Uint64("version", uint64(version)))
+	return nil
+}
+
+// MigrationStatus reports the current schema version of the datastore, the version of the latest embedded
+// migration and whether migrations are pending, without applying them. A health endpoint can use it to
+// surface pending migrations. A missing sqlite file is reported at version 0, with the migrations pending.
+func MigrationStatus(engine, uri string) (current, target uint, pending bool, err error) {
+	target, err = LatestSchemaVersion(engine)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	current, err = SchemaVersion(context.Background(), engine, uri)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, false, err
+	}
+	return current, target, current < target, nil
+}
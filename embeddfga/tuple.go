@@ -0,0 +1,96 @@
+package embeddfga
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/openfga/openfga/pkg/tuple"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Tuple is a relationship tuple, e.g. user "user:anne" is "viewer" of object "document:1".
+// It is the tuple type shared by the cmd and fgaclient packages.
+type Tuple struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	User     string `json:"user"`
+	// Condition is the optional name of the model condition the tuple is granted under, the parameters missing
+	// from ConditionContext are provided by the condition context of the Check. It is ignored by Check and Delete.
+	Condition string `json:"condition,omitempty"`
+	// ConditionContext holds the condition parameters written with the tuple, e.g. {"valid_until": "..."}. It makes
+	// Tuple not comparable, compare or key the tuples by ID, the tuples of a store are unique by ID.
+	ConditionContext map[string]any `json:"condition_context,omitempty"`
+}
+
+// FromTupleKey converts an OpenFGA tuple key to a Tuple, including its condition, if any.
+func FromTupleKey(tk *openfgav1.TupleKey) Tuple {
+	t := Tuple{Object: tk.GetObject(), Relation: tk.GetRelation(), User: tk.GetUser(), Condition: tk.GetCondition().GetName()}
+	if fields := tk.GetCondition().GetContext(); len(fields.GetFields()) > 0 {
+		t.ConditionContext = fields.AsMap()
+	}
+	return t
+}
+
+// TupleKey returns the tuple key used in write and read requests. It fails when the ConditionContext cannot be
+// converted to a protobuf Struct.
+func (t Tuple) TupleKey() (*openfgav1.TupleKey, error) {
+	var conditionContext *structpb.Struct
+	if t.ConditionContext != nil {
+		var err error
+		if conditionContext, err = structpb.NewStruct(t.ConditionContext); err != nil {
+			return nil, fmt.Errorf("invalid condition context for %s: %w", t, err)
+		}
+	}
+	return tuple.NewTupleKeyWithCondition(t.Object, t.Relation, t.User, t.Condition, conditionContext), nil
+}
+
+// TupleKeyWithoutCondition returns the tuple key used in delete requests.
+func (t Tuple) TupleKeyWithoutCondition() *openfgav1.TupleKeyWithoutCondition {
+	return &openfgav1.TupleKeyWithoutCondition{Object: t.Object, Relation: t.Relation, User: t.User}
+}
+
+// CheckRequestTupleKey returns the tuple key used in check requests.
+func (t Tuple) CheckRequestTupleKey() *openfgav1.CheckRequestTupleKey {
+	return tuple.NewCheckRequestTupleKey(t.Object, t.Relation, t.User)
+}
+
+// ID returns the tuple without its condition, the tuples of a store are unique by ID.
+func (t Tuple) ID() TupleID {
+	return TupleID{Object: t.Object, Relation: t.Relation, User: t.User}
+}
+
+// TupleID identifies a tuple regardless of its condition, see Tuple.ID.
+type TupleID struct {
+	Object   string
+	Relation string
+	User     string
+}
+
+// String returns the tuple in the OpenFGA "object#relation@user" notation.
+func (t Tuple) String() string {
+	return tuple.TupleKeyToString(t.TupleKeyWithoutCondition())
+}
+
+// Validate checks the tuple has the "type:id" object, relation and user formats and the length limits accepted
+// by OpenFGA, so malformed tuples (e.g. from user input) are rejected before they reach the datastore.
+func (t Tuple) Validate() error {
+	if !utf8.ValidString(t.Object) || !tuple.IsValidObject(t.Object) || tuple.IsTypedWildcard(t.Object) || utf8.RuneCountInString(t.Object) > 256 {
+		return fmt.Errorf("invalid object %q, expected type:id", t.Object)
+	}
+	if !utf8.ValidString(t.Relation) || !tuple.IsValidRelation(t.Relation) || utf8.RuneCountInString(t.Relation) > 50 {
+		return fmt.Errorf("invalid relation %q", t.Relation)
+	}
+	if !utf8.ValidString(t.User) || !tuple.IsValidUser(t.User) || len(t.User) > 512 {
+		return fmt.Errorf("invalid user %q, expected type:id, type:* or type:id#relation", t.User)
+	}
+	if t.ConditionContext != nil {
+		if t.Condition == "" {
+			return fmt.Errorf("condition context without a condition for %s", t)
+		}
+		if _, err := t.TupleKey(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package embeddfga
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTupleConversion(t *testing.T) {
+	tpl := Tuple{Object: "document:1", Relation: "viewer", User: "group:admins#member"}
+	tk, err := tpl.TupleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FromTupleKey(tk); got.ID() != tpl.ID() || got.Condition != "" || got.ConditionContext != nil {
+		t.Errorf("FromTupleKey(TupleKey()) = %+v, want %+v", got, tpl)
+	}
+	if tk := tpl.TupleKeyWithoutCondition(); tk.GetObject() != tpl.Object || tk.GetRelation() != tpl.Relation || tk.GetUser() != tpl.User {
+		t.Errorf("unexpected tuple key without condition %+v for %+v", tk, tpl)
+	}
+	if tk := tpl.CheckRequestTupleKey(); tk.GetObject() != tpl.Object || tk.GetRelation() != tpl.Relation || tk.GetUser() != tpl.User {
+		t.Errorf("unexpected check request tuple key %+v for %+v", tk, tpl)
+	}
+	conditional := Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "business_hours"}
+	tk, err = conditional.TupleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.GetCondition().GetName() != "business_hours" {
+		t.Errorf("expected the tuple key to carry the condition, got %+v", tk)
+	}
+	if got := FromTupleKey(tk); got.ID() != conditional.ID() || got.Condition != conditional.Condition || got.ConditionContext != nil {
+		t.Errorf("FromTupleKey(TupleKey()) = %+v, want %+v", got, conditional)
+	}
+	withContext := Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "temporary_grant",
+		ConditionContext: map[string]any{"valid_until": "2024-01-01T10:00:00Z"}}
+	tk, err = withContext.TupleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := FromTupleKey(tk)
+	if got.ID() != withContext.ID() || got.Condition != withContext.Condition || got.ConditionContext == nil ||
+		len(got.ConditionContext) != 1 || got.ConditionContext["valid_until"] != "2024-01-01T10:00:00Z" {
+		t.Errorf("FromTupleKey(TupleKey()) = %+v, want %+v", got, withContext)
+	}
+	if withContext.ID() != conditional.ID() {
+		t.Errorf("expected the ID to ignore the condition, got %+v and %+v", withContext.ID(), conditional.ID())
+	}
+	invalid := Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "temporary_grant",
+		ConditionContext: map[string]any{"valid_until": make(chan int)}}
+	if _, err := invalid.TupleKey(); err == nil {
+		t.Error("expected an error for a condition context which cannot be converted")
+	}
+	if got, want := tpl.String(), "document:1#viewer@group:admins#member"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestTupleJSON(t *testing.T) {
+	var tpl Tuple
+	if err := json.Unmarshal([]byte(`{"object":"document:1","relation":"viewer","user":"user:anne"}`), &tpl); err != nil {
+		t.Fatalf("failed to unmarshal tuple: %+v", err)
+	}
+	if want := (TupleID{Object: "document:1", Relation: "viewer", User: "user:anne"}); tpl.ID() != want || tpl.Condition != "" || tpl.ConditionContext != nil {
+		t.Errorf("unmarshalled %+v, want %+v", tpl, want)
+	}
+	if err := json.Unmarshal([]byte(`{"object":"document:1","relation":"viewer","user":"user:anne",
+		"condition":"temporary_grant","condition_context":{"valid_until":"2024-01-01T10:00:00Z"}}`), &tpl); err != nil {
+		t.Fatalf("failed to unmarshal tuple: %+v", err)
+	}
+	if tpl.Condition != "temporary_grant" || len(tpl.ConditionContext) != 1 || tpl.ConditionContext["valid_until"] != "2024-01-01T10:00:00Z" {
+		t.Errorf("unmarshalled %+v, want the condition and its context", tpl)
+	}
+}
+
+func TestTupleValidate(t *testing.T) {
+	for _, tc := range []struct {
+		tuple Tuple
+		valid bool
+	}{
+		{Tuple{Object: "document:1", Relation: "viewer", User: "user:anne"}, true},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "user:*"}, true},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "group:admins#member"}, true},
+		{Tuple{Object: "document:ünïcode", Relation: "viewer", User: "user:anne"}, true},
+		{Tuple{Object: "document", Relation: "viewer", User: "user:anne"}, false},
+		{Tuple{Object: "document:", Relation: "viewer", User: "user:anne"}, false},
+		{Tuple{Object: "document:1:2", Relation: "viewer", User: "user:anne"}, false},
+		{Tuple{Object: "document:*", Relation: "viewer", User: "user:anne"}, false},
+		{Tuple{Object: "document:1", Relation: "", User: "user:anne"}, false},
+		{Tuple{Object: "document:1", Relation: "view er", User: "user:anne"}, false},
+		{Tuple{Object: "document:1", Relation: "viewer", User: ""}, false},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "user:anne#member#x"}, false},
+		{Tuple{Object: "document:\xff", Relation: "viewer", User: "user:anne"}, false},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "temporary_grant", ConditionContext: map[string]any{"valid_until": "2024-01-01T10:00:00Z"}}, true},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", ConditionContext: map[string]any{"valid_until": "2024-01-01T10:00:00Z"}}, false},
+		{Tuple{Object: "document:1", Relation: "viewer", User: "user:anne", Condition: "temporary_grant", ConditionContext: map[string]any{"valid_until": make(chan int)}}, false},
+	} {
+		if err := tc.tuple.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Validate(%+v) = %v, want valid=%v", tc.tuple, err, tc.valid)
+		}
+	}
+}
+
+func FuzzValidateTuple(f *testing.F) {
+	f.Add("document:1", "viewer", "user:anne")
+	f.Add("document:1", "viewer", "group:admins#member")
+	f.Add("document:1", "viewer", "user:*")
+	f.Add("document::1", "view#er", "user:anne:x")
+	f.Add("", "", "")
+	f.Add("dokument:ß", "betrachter", "benutzer:jürgen")
+	f.Fuzz(func(t *testing.T, object, relation, user string) {
+		tpl := Tuple{Object: object, Relation: relation, User: user}
+		err := tpl.Validate()
+		if again := tpl.Validate(); (again == nil) != (err == nil) {
+			t.Fatalf("inconsistent validation of %+v: %v then %v", tpl, err, again)
+		}
+		tk, keyErr := tpl.TupleKey()
+		if keyErr != nil {
+			t.Fatalf("failed to convert %+v: %v", tpl, keyErr)
+		}
+		_ = tpl.CheckRequestTupleKey()
+		_ = tpl.TupleKeyWithoutCondition()
+		_ = tpl.String()
+		if err == nil {
+			if protoErr := tk.Validate(); protoErr != nil {
+				t.Fatalf("tuple %+v accepted locally but rejected by OpenFGA: %v", tpl, protoErr)
+			}
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package fgaclient
+
+import (
+	"context"
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// readChangesPageSize is the page size used when paging through ReadChanges, it is the maximum allowed by OpenFGA.
+const readChangesPageSize = 100
+
+// ReplayChanges calls fn with every change of the changelog after the since token (empty to replay from the
+// start) in order, and returns the token to pass as since to continue after the last change, e.g. to build a
+// materialized view of the tuples and keep it up to date. The replay stops at the first error of fn; the
+// returned token is then the one before the page of the failed change, so fn must tolerate seeing the changes
+// of that page again on the next replay.
+func (c *Conn) ReplayChanges(ctx context.Context, since string, fn func(*openfgav1.TupleChange) error) (string, error) {
+	token := since
+	for {
+		r, err := c.fgaServer.ReadChanges(ctx, &openfgav1.ReadChangesRequest{
+			StoreId:           c.storeID,
+			PageSize:          wrapperspb.Int32(readChangesPageSize),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return token, fmt.Errorf("failed to read changes from OpenFGA: %w", err)
+		}
+		for _, change := range r.GetChanges() {
+			if err := fn(change); err != nil {
+				return token, err
+			}
+		}
+		if r.GetContinuationToken() != "" {
+			token = r.GetContinuationToken()
+		}
+		if len(r.GetChanges()) < readChangesPageSize {
+			return token, nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package fgaclient
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+func TestReplayChanges(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	var tuples []embeddfga.Tuple
+	for i := range 150 {
+		tuples = append(tuples, embeddfga.Tuple{Object: "document:1", Relation: "viewer", User: fmt.Sprintf("user:%d@example.com", i)})
+	}
+	if err := conn.AddTuples(t.Context(), tuples); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	// a materialized view of the viewers of document:1
+	viewers := map[string]bool{}
+	apply := func(change *openfgav1.TupleChange) error {
+		viewers[change.GetTupleKey().GetUser()] = change.GetOperation() == openfgav1.TupleOperation_TUPLE_OPERATION_WRITE
+		return nil
+	}
+	token, err := conn.ReplayChanges(t.Context(), "", apply)
+	if err != nil {
+		t.Fatalf("failed to replay the changes: %+v", err)
+	}
+	if len(viewers) != 150 || token == "" {
+		t.Fatalf("expected the 150 changes of 2 pages and a token, got %d changes, token %q", len(viewers), token)
+	}
+
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{{Object: "document:1", Relation: "viewer", User: "user:late@example.com"}}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+	replayed := 0
+	next, err := conn.ReplayChanges(t.Context(), token, func(change *openfgav1.TupleChange) error {
+		replayed++
+		return apply(change)
+	})
+	if err != nil {
+		t.Fatalf("failed to replay the changes: %+v", err)
+	}
+	if replayed != 1 || !viewers["user:late@example.com"] || next == token {
+		t.Errorf("expected only the new change to be replayed and the token to move, got %d changes, token %q", replayed, next)
+	}
+
+	errStop := errors.New("stop")
+	if failed, err := conn.ReplayChanges(t.Context(), "", func(*openfgav1.TupleChange) error { return errStop }); !errors.Is(err, errStop) || failed != "" {
+		t.Errorf("expected the error of fn and the since token, got %q, %+v", failed, err)
+	}
+}
@@ -2,92 +2,134 @@ package fgaclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/amikos-tech/embedded-openfga/embeddfga"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 	parser "github.com/openfga/language/pkg/go/transformer"
 	"github.com/openfga/openfga/pkg/server"
+	"github.com/openfga/openfga/pkg/storage"
 	"github.com/openfga/openfga/pkg/tuple"
 )
 
 type Conn struct {
 	fgaServer            *server.Server
+	closeDatastore       func() error // closeDatastore closes the datastore once fgaServer is closed, see Close
+	ensureMu             sync.Mutex   // ensureMu serializes EnsureStore and EnsureModel
 	storeName            string
 	storeID              string
 	authorizationModelID string
 }
 
-func NewEmbeddedSqlite(ctx context.Context, datastoreURI string, modelData []byte, storeName string) (*Conn, error) {
+// OpenEmbeddedSqlite opens the sqlite datastore at datastoreURI and returns a Conn bound to no store yet: bind it
+// with EnsureStore then EnsureModel, e.g. to control the bootstrap ordering NewEmbeddedSqlite does in one step.
+func OpenEmbeddedSqlite(datastoreURI string) (*Conn, error) {
 	if datastoreURI == "" {
 		return nil, fmt.Errorf("datastoreURI cannot be empty")
 	}
+	fgaServer, closeDatastore, err := embeddfga.NewSqliteServerWithCloser(datastoreURI)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{fgaServer: fgaServer, closeDatastore: closeDatastore}, nil
+}
+
+// OpenEmbedded is OpenEmbeddedSqlite on a migrated datastore, e.g. a storage/memory one in unit tests. The Conn
+// owns the datastore: Close closes it and returns the error of an embeddfga.ErrorClosingDatastore.
+func OpenEmbedded(ds storage.OpenFGADatastore) (*Conn, error) {
+	fgaServer, closeDatastore, err := embeddfga.NewServerWithDatastore(ds)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{fgaServer: fgaServer, closeDatastore: closeDatastore}, nil
+}
+
+// EnsureStore returns the ID of the oldest store named name, creating it if missing, and binds the Conn to it.
+// It is idempotent and safe to call concurrently, across processes it is best effort, see embeddfga.EnsureStore.
+func (c *Conn) EnsureStore(ctx context.Context, name string) (string, error) {
+	c.ensureMu.Lock()
+	defer c.ensureMu.Unlock()
+	storeID, err := embeddfga.EnsureStore(ctx, c.fgaServer, embeddfga.BootstrapConfig{StoreName: name})
+	if err != nil {
+		return "", err
+	}
+	if storeID != c.storeID {
+		c.authorizationModelID = ""
+	}
+	c.storeName, c.storeID = name, storeID
+	return storeID, nil
+}
+
+// EnsureModel returns the ID of the authorization model of the store identical to the model in the OpenFGA DSL,
+// writing it as the latest model if missing, and binds the Conn to it. It requires EnsureStore first. It is
+// idempotent and safe to call concurrently, processes writing the same model concurrently converge on one model.
+func (c *Conn) EnsureModel(ctx context.Context, dsl string) (string, error) {
+	c.ensureMu.Lock()
+	defer c.ensureMu.Unlock()
+	if c.storeID == "" {
+		return "", fmt.Errorf("no store bound, call EnsureStore first")
+	}
+	if strings.TrimSpace(dsl) == "" {
+		return "", fmt.Errorf("model data is empty")
+	}
+	model, err := parser.TransformDSLToProto(dsl)
+	if err != nil {
+		return "", fmt.Errorf("failed to transform DSL to OpenFGA model: %w", err)
+	}
+	modelID, err := embeddfga.EnsureModel(ctx, c.fgaServer, c.storeID, embeddfga.BootstrapConfig{Model: model})
+	if err != nil {
+		return "", err
+	}
+	c.authorizationModelID = modelID
+	return modelID, nil
+}
+
+func NewEmbeddedSqlite(ctx context.Context, datastoreURI string, modelData []byte, storeName string) (_ *Conn, err error) {
+	if datastoreURI == "" {
+		return nil, fmt.Errorf("datastoreURI cannot be empty")
+	}
+	if strings.TrimSpace(string(modelData)) == "" {
+		return nil, fmt.Errorf("model data is empty")
+	}
 
 	conn := Conn{
 		storeName: storeName,
 	}
 
 	// Create a new server
-	fgaServer, err := embeddfga.NewSqliteServer(datastoreURI)
+	fgaServer, closeDatastore, err := embeddfga.NewSqliteServerWithCloser(datastoreURI)
 	if err != nil {
 		return nil, err
 	}
 	defer func() {
 		if fgaServer != nil {
 			fgaServer.Close()
+			err = errors.Join(err, closeDatastore())
 		}
 	}()
 
-	// Create or lookup the store
-	stores, err := fgaServer.ListStores(ctx, &openfgav1.ListStoresRequest{Name: conn.storeName})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list stores: %w", err)
-	}
-	if len(stores.Stores) == 0 {
-		cs, err := fgaServer.CreateStore(ctx, &openfgav1.CreateStoreRequest{
-			Name: storeName,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to create store: %w", err)
-		}
-		conn.storeID = cs.GetId()
-		slog.Debug("Store created", slog.String("storeName", conn.storeName), slog.String("storeId", conn.storeID))
-	} else {
-		conn.storeID = stores.Stores[0].GetId()
-		slog.Debug("Store found", slog.String("storeName", conn.storeName), slog.String("storeId", conn.storeID))
-	}
-
 	model, err := parser.TransformDSLToProto(string(modelData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to transform DSL to OpenFGA model: %w", err)
 	}
 
-	models, err := fgaServer.ReadAuthorizationModels(ctx, &openfgav1.ReadAuthorizationModelsRequest{
-		StoreId: conn.storeID,
+	// Create or lookup the store and its authorization model
+	conn.storeID, conn.authorizationModelID, err = embeddfga.Bootstrap(ctx, fgaServer, embeddfga.BootstrapConfig{
+		StoreName: storeName,
+		Model:     model,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read authorization models: %w", err)
-	}
-
-	if len(models.GetAuthorizationModels()) == 0 {
-		r, err := fgaServer.WriteAuthorizationModel(ctx, &openfgav1.WriteAuthorizationModelRequest{
-			StoreId:         conn.storeID,
-			SchemaVersion:   model.GetSchemaVersion(),
-			TypeDefinitions: model.GetTypeDefinitions(),
-			Conditions:      model.GetConditions(), // in this demo we don't use conditions, but you can add them and use them in your model
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to write the authorization model: %w", err)
-		}
-		conn.authorizationModelID = r.GetAuthorizationModelId()
-		slog.Debug("Authorization model created", slog.String("authModelId", conn.authorizationModelID))
-	} else {
-		conn.authorizationModelID = models.GetAuthorizationModels()[0].GetId()
-		slog.Debug("Authorization model found", slog.String("authModelId", conn.authorizationModelID))
+		return nil, err
 	}
 
-	conn.fgaServer = fgaServer
+	conn.fgaServer, conn.closeDatastore = fgaServer, closeDatastore
 	fgaServer = nil
 	slog.Info("Connected to OpenFGA server",
 		slog.String("authModelId", conn.authorizationModelID),
@@ -96,36 +138,217 @@ func NewEmbeddedSqlite(ctx context.Context, datastoreURI string, modelData []byt
 	return &conn, nil
 }
 
-func (c *Conn) Close() {
+// Close closes the embedded server and its datastore, a second Close does nothing. It returns the close failures
+// of the datastore, e.g. to log them on shutdown, it mirrors OpenFGAServer.Close.
+func (c *Conn) Close() error {
+	if c.fgaServer == nil {
+		return nil
+	}
 	c.fgaServer.Close()
+	c.fgaServer = nil
+	err := c.closeDatastore()
+	c.closeDatastore = nil
+	return err
 }
 
-func (c *Conn) AddTuples(ctx context.Context, tuples []*tuple.Tuple) error {
-	var tupleKeys []*openfgav1.TupleKey
+// Server returns the embedded OpenFGA server, an escape hatch for the endpoints Conn does not wrap (e.g. the
+// streaming APIs). The requests must pass StoreID and AuthorizationModelID themselves, and the server must not be
+// closed directly, Close does it.
+func (c *Conn) Server() *server.Server {
+	return c.fgaServer
+}
+
+// StoreID returns the ID of the store the Conn is bound to.
+func (c *Conn) StoreID() string {
+	return c.storeID
+}
+
+// AuthorizationModelID returns the ID of the authorization model the Conn is bound to.
+func (c *Conn) AuthorizationModelID() string {
+	return c.authorizationModelID
+}
+
+// maxTuplesPerWrite is the maximum number of tuple operations OpenFGA accepts in a single WriteRequest.
+const maxTuplesPerWrite = 100
+
+// AddTuples writes the tuples in WriteRequests of at most maxTuplesPerWrite tuples, so any number of tuples can
+// be passed. The requests are not atomic with each other: on error the previous batches remain written.
+// All the tuples are validated before the first request is sent.
+func (c *Conn) AddTuples(ctx context.Context, tuples []embeddfga.Tuple) error {
 	for _, tpl := range tuples {
-		tupleKeys = append(tupleKeys, tuple.NewTupleKey(tpl.Object, tpl.Relation, tpl.User))
+		if err := tpl.Validate(); err != nil {
+			return fmt.Errorf("invalid tuple: %w", err)
+		}
 	}
-	_, err := c.fgaServer.Write(ctx, &openfgav1.WriteRequest{
-		StoreId:              c.storeID,
-		AuthorizationModelId: c.authorizationModelID,
-		Writes: &openfgav1.WriteRequestWrites{
-			TupleKeys: tupleKeys,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to write tuple to OpenFGA: %w", err)
+	for start := 0; start < len(tuples); start += maxTuplesPerWrite {
+		var tupleKeys []*openfgav1.TupleKey
+		for _, tpl := range tuples[start:min(start+maxTuplesPerWrite, len(tuples))] {
+			tk, err := tpl.TupleKey()
+			if err != nil {
+				return fmt.Errorf("invalid tuple: %w", err)
+			}
+			tupleKeys = append(tupleKeys, tk)
+		}
+		_, err := c.fgaServer.Write(ctx, &openfgav1.WriteRequest{
+			StoreId:              c.storeID,
+			AuthorizationModelId: c.authorizationModelID,
+			Writes: &openfgav1.WriteRequestWrites{
+				TupleKeys: tupleKeys,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write tuple to OpenFGA: %w", err)
+		}
 	}
 	return nil
 }
 
-func (c *Conn) Check(ctx context.Context, t *tuple.Tuple) (bool, error) {
+func (c *Conn) Check(ctx context.Context, t embeddfga.Tuple) (bool, error) {
+	return c.CheckWithModel(ctx, t, c.authorizationModelID)
+}
+
+// CheckString checks a tuple in the OpenFGA "object#relation@user" notation, e.g. "document:1#viewer@user:alice"
+// as found in the logs, which helps replaying logged authorization decisions.
+func (c *Conn) CheckString(ctx context.Context, rel string) (bool, error) {
+	tk, err := tuple.ParseTupleString(strings.TrimSpace(rel))
+	if err != nil {
+		return false, fmt.Errorf("failed to parse tuple %q: %w", rel, err)
+	}
+	return c.Check(ctx, embeddfga.FromTupleKey(tk))
+}
+
+// CheckWithModel evaluates the tuple against the given authorization model instead of the one the Conn is
+// bound to, so a single Conn can pin some requests to an older model during a gradual model migration.
+func (c *Conn) CheckWithModel(ctx context.Context, t embeddfga.Tuple, modelID string) (bool, error) {
+	if modelID == "" {
+		return false, fmt.Errorf("authorization model ID cannot be empty")
+	}
+	return c.check(ctx, t, modelID, openfgav1.ConsistencyPreference_UNSPECIFIED)
+}
+
+// CheckFresh evaluates the tuple against the datastore, skipping the check query cache for this call only.
+// Use it for security-critical checks (e.g. admin access) that must not see a revoked grant still cached.
+func (c *Conn) CheckFresh(ctx context.Context, t embeddfga.Tuple) (bool, error) {
+	return c.check(ctx, t, c.authorizationModelID, openfgav1.ConsistencyPreference_HIGHER_CONSISTENCY)
+}
+
+// waitForTuplePollInterval is the delay between two checks of WaitForTuple.
+const waitForTuplePollInterval = 10 * time.Millisecond
+
+// WaitForTuple polls CheckFresh until the tuple is allowed, so tests can wait for a write to be visible instead
+// of sleeping. It fails when the tuple is still not allowed after the timeout or when a check fails.
+func (c *Conn) WaitForTuple(ctx context.Context, t embeddfga.Tuple, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(waitForTuplePollInterval)
+	defer ticker.Stop()
+	for {
+		allowed, err := c.CheckFresh(ctx, t)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("tuple %s is not visible after %s: %w", t, timeout, ctx.Err())
+			}
+			return err
+		}
+		if allowed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("tuple %s is not visible after %s: %w", t, timeout, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Conn) check(ctx context.Context, t embeddfga.Tuple, modelID string, consistency openfgav1.ConsistencyPreference) (bool, error) {
 	v, err := c.fgaServer.Check(ctx, &openfgav1.CheckRequest{
 		StoreId:              c.storeID,
-		AuthorizationModelId: c.authorizationModelID,
-		TupleKey:             tuple.NewCheckRequestTupleKey(t.Object, t.Relation, t.User),
+		AuthorizationModelId: modelID,
+		TupleKey:             t.CheckRequestTupleKey(),
+		Consistency:          consistency,
 	})
 	if err != nil {
 		return false, fmt.Errorf("failed to check tuple in OpenFGA: %w", err)
 	}
 	return v.GetAllowed(), nil
 }
+
+// RestoreSqlite copies a sqlite snapshot (e.g. taken with VACUUM INTO) to the targetURI file and opens a Conn
+// bound to its store and latest authorization model. The snapshot must hold a single store and be at the
+// schema version the server expects, the targetURI file must not exist.
+func RestoreSqlite(ctx context.Context, snapshotPath, targetURI string) (_ *Conn, err error) {
+	if _, err := os.Stat(snapshotPath); err != nil {
+		return nil, fmt.Errorf("failed to open the snapshot: %w", err)
+	}
+	version, err := embeddfga.SchemaVersion(ctx, "sqlite", snapshotPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the snapshot schema version: %w", err)
+	}
+	if version != embeddfga.SqliteSchemaVersion {
+		return nil, fmt.Errorf("snapshot schema version %d is incompatible, the server expects version %d", version, embeddfga.SqliteSchemaVersion)
+	}
+	if err := copyFile(snapshotPath, targetURI); err != nil {
+		return nil, fmt.Errorf("failed to copy the snapshot: %w", err)
+	}
+
+	fgaServer, closeDatastore, err := embeddfga.NewSqliteServerWithCloser(targetURI)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if fgaServer != nil {
+			fgaServer.Close()
+			err = errors.Join(err, closeDatastore())
+		}
+	}()
+
+	stores, err := fgaServer.ListStores(ctx, &openfgav1.ListStoresRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stores: %w", err)
+	}
+	if len(stores.GetStores()) != 1 {
+		return nil, fmt.Errorf("expected a single store in the snapshot, found %d", len(stores.GetStores()))
+	}
+	conn := Conn{
+		storeName: stores.GetStores()[0].GetName(),
+		storeID:   stores.GetStores()[0].GetId(),
+	}
+	models, err := fgaServer.ReadAuthorizationModels(ctx, &openfgav1.ReadAuthorizationModelsRequest{
+		StoreId: conn.storeID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authorization models: %w", err)
+	}
+	if len(models.GetAuthorizationModels()) == 0 {
+		return nil, fmt.Errorf("no authorization model found in the snapshot")
+	}
+	conn.authorizationModelID = models.GetAuthorizationModels()[0].GetId()
+
+	conn.fgaServer, conn.closeDatastore = fgaServer, closeDatastore
+	fgaServer = nil
+	slog.Info("Restored OpenFGA snapshot",
+		slog.String("snapshot", snapshotPath), slog.String("target", embeddfga.RedactURI(targetURI)),
+		slog.String("authModelId", conn.authorizationModelID),
+		slog.String("storeName", conn.storeName), slog.String("storeId", conn.storeID),
+	)
+	return &conn, nil
+}
+
+// copyFile copies src to dst, failing if dst already exists.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
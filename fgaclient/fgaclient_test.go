@@ -1,49 +1,333 @@
 package fgaclient
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/openfga/openfga/pkg/tuple"
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	parser "github.com/openfga/language/pkg/go/transformer"
+	"github.com/openfga/openfga/pkg/storage"
+	"github.com/openfga/openfga/pkg/storage/memory"
 )
 
-func TestFgaClient(t *testing.T) {
+// readTestModel returns the example model of the repository.
+func readTestModel(t *testing.T) []byte {
+	t.Helper()
 	modelData, err := os.ReadFile("../model.fga")
 	if err != nil {
 		t.Fatalf("failed to read the model file: %+v", err)
 	}
-	conn, err := NewEmbeddedSqlite(t.Context(), t.TempDir()+"/openfga.db", modelData, "TEST_STORE")
+	return modelData
+}
+
+// newTestConn returns a Conn on a new sqlite datastore at datastoreURI, bound to the TEST_STORE store and the
+// example model. It is closed when the test ends.
+func newTestConn(t *testing.T, datastoreURI string) *Conn {
+	t.Helper()
+	conn, err := NewEmbeddedSqlite(t.Context(), datastoreURI, readTestModel(t), "TEST_STORE")
 	if err != nil {
 		t.Fatalf("failed to create embedded OpenFGA server: %+v", err)
 	}
-	defer conn.Close()
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func TestFgaClient(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
 
-	conn.AddTuples(t.Context(), []*tuple.Tuple{
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{
 		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
 		{Object: "document:2", Relation: "editor", User: "user:test@example.com"},
 		{Object: "document:2", Relation: "viewer", User: "user:another@example.com"},
 		{Object: "app:auth", Relation: "admin", User: "user:test@example.com"},
+	}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	for _, tc := range []struct {
+		tuple embeddfga.Tuple
+		want  bool
+	}{
+		{embeddfga.Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}, true},
+		{embeddfga.Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}, false},
+		{embeddfga.Tuple{Object: "document:2", Relation: "viewer", User: "user:another@example.com"}, true},
+		{embeddfga.Tuple{Object: "document:2", Relation: "editor", User: "user:another@example.com"}, false},
+		{embeddfga.Tuple{Object: "app:auth", Relation: "admin", User: "user:another@example.com"}, false},
+	} {
+		if got, err := conn.Check(t.Context(), tc.tuple); err != nil || got != tc.want {
+			t.Errorf("Check(%s) = %v, %+v, want %v", tc.tuple, got, err, tc.want)
+		}
+	}
+}
+
+func TestEnsureStoreAndModel(t *testing.T) {
+	modelData := readTestModel(t)
+	conn, err := OpenEmbeddedSqlite(t.TempDir() + "/openfga.db")
+	if err != nil {
+		t.Fatalf("failed to open embedded OpenFGA server: %+v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.EnsureModel(t.Context(), string(modelData)); err == nil {
+		t.Error("expected an error ensuring a model without a store")
+	}
+
+	// concurrent calls all converge on the same store and model
+	const workers = 8
+	storeIDs, modelIDs, errs := make([]string, workers), make([]string, workers), make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if storeIDs[i], errs[i] = conn.EnsureStore(t.Context(), "TEST_STORE"); errs[i] == nil {
+				modelIDs[i], errs[i] = conn.EnsureModel(t.Context(), string(modelData))
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range workers {
+		if errs[i] != nil {
+			t.Fatalf("failed to ensure the store and the model: %+v", errs[i])
+		}
+		if storeIDs[i] != storeIDs[0] || modelIDs[i] != modelIDs[0] {
+			t.Errorf("expected the store %s and the model %s, got %s and %s", storeIDs[0], modelIDs[0], storeIDs[i], modelIDs[i])
+		}
+	}
+	if conn.StoreID() != storeIDs[0] || conn.AuthorizationModelID() != modelIDs[0] {
+		t.Errorf("expected the Conn bound to the ensured store and model, got %s and %s", conn.StoreID(), conn.AuthorizationModelID())
+	}
+
+	// a changed model is written as a new model
+	changed := strings.Replace(string(modelData), "type user\n", "type user\n\ntype ensure_test\n", 1)
+	modelID, err := conn.EnsureModel(t.Context(), changed)
+	if err != nil {
+		t.Fatalf("failed to ensure the changed model: %+v", err)
+	}
+	if modelID == modelIDs[0] {
+		t.Error("expected a new model ID for the changed model")
+	}
+	if again, err := conn.EnsureModel(t.Context(), changed); err != nil || again != modelID {
+		t.Errorf("EnsureModel() = %s, %+v, want %s", again, err, modelID)
+	}
+
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+	editor := embeddfga.Tuple{Object: "document:1", Relation: "editor", User: "user:test@example.com"}
+	if got, err := conn.Check(t.Context(), editor); err != nil || !got {
+		t.Errorf("Check(%s) = %v, %+v, want true", editor, got, err)
+	}
+}
+
+func TestCheckWithModel(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	// the newer model no longer derives viewer from editor
+	newModel, err := parser.TransformDSLToProto(strings.ReplaceAll(string(readTestModel(t)), " or editor\n", "\n"))
+	if err != nil {
+		t.Fatalf("failed to transform DSL to OpenFGA model: %+v", err)
+	}
+	r, err := conn.fgaServer.WriteAuthorizationModel(t.Context(), &openfgav1.WriteAuthorizationModelRequest{
+		StoreId:         conn.storeID,
+		SchemaVersion:   newModel.GetSchemaVersion(),
+		TypeDefinitions: newModel.GetTypeDefinitions(),
+		Conditions:      newModel.GetConditions(),
 	})
+	if err != nil {
+		t.Fatalf("failed to write the authorization model: %+v", err)
+	}
 
-	if v, err := conn.Check(t.Context(),
-		&tuple.Tuple{
-			Object:   "document:1",
-			Relation: "editor",
-			User:     "user:test@example.com",
-		}); err != nil {
-		t.Errorf("failed to check tuple: %+v", err)
-	} else {
-		t.Log("Allowed:", v)
-	}
-	if v, err := conn.Check(t.Context(),
-		&tuple.Tuple{
-			Object:   "document:1",
-			Relation: "editor",
-			User:     "user:anoter@example.com",
-		}); err != nil {
-		t.Errorf("failed to check tuple: %+v", err)
-	} else {
-		t.Log("Allowed:", v)
+	viewer := embeddfga.Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}
+	if v, err := conn.Check(t.Context(), viewer); err != nil || !v {
+		t.Errorf("expected the pinned model to allow, got %v, %+v", v, err)
+	}
+	if v, err := conn.CheckWithModel(t.Context(), viewer, r.GetAuthorizationModelId()); err != nil || v {
+		t.Errorf("expected the new model to deny, got %v, %+v", v, err)
 	}
+}
+
+// failingCloseDatastore fails to flush on close.
+type failingCloseDatastore struct {
+	storage.OpenFGADatastore
+	closed int
+}
+
+var errFlush = errors.New("flush failed")
+
+func (ds *failingCloseDatastore) CloseWithError() error {
+	ds.closed++
+	ds.OpenFGADatastore.Close()
+	return errFlush
+}
 
+func TestCloseError(t *testing.T) {
+	ds := &failingCloseDatastore{OpenFGADatastore: memory.New()}
+	conn, err := OpenEmbedded(ds)
+	if err != nil {
+		t.Fatalf("failed to open embedded OpenFGA server: %+v", err)
+	}
+	if _, err := conn.EnsureStore(context.Background(), "test"); err != nil {
+		t.Fatalf("EnsureStore() = %+v", err)
+	}
+	if err := conn.Close(); !errors.Is(err, errFlush) {
+		t.Errorf("Close() = %v, want %v", err, errFlush)
+	}
+	if err := conn.Close(); err != nil {
+		t.Errorf("second Close() = %v, want nil", err)
+	}
+	if ds.closed != 1 {
+		t.Errorf("datastore closed %d times, want 1", ds.closed)
+	}
+}
+
+func TestRestoreSqlite(t *testing.T) {
+	snapshotPath := t.TempDir() + "/openfga.db"
+	conn := newTestConn(t, snapshotPath)
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+	conn.Close()
+
+	restored, err := RestoreSqlite(t.Context(), snapshotPath, t.TempDir()+"/restored.db")
+	if err != nil {
+		t.Fatalf("failed to restore the snapshot: %+v", err)
+	}
+	defer restored.Close()
+	if restored.storeID != conn.storeID || restored.authorizationModelID != conn.authorizationModelID {
+		t.Errorf("restored store %s model %s, want store %s model %s",
+			restored.storeID, restored.authorizationModelID, conn.storeID, conn.authorizationModelID)
+	}
+	if v, err := restored.Check(t.Context(), embeddfga.Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}); err != nil || !v {
+		t.Errorf("expected the restored tuple to be allowed, got %v, %+v", v, err)
+	}
+}
+
+func TestRestoreSqliteIncompatibleSnapshot(t *testing.T) {
+	snapshotPath := t.TempDir() + "/old.db"
+	db, err := sql.Open("sqlite", snapshotPath)
+	if err != nil {
+		t.Fatalf("failed to open the snapshot: %+v", err)
+	}
+	if _, err := db.Exec(`CREATE TABLE goose_db_version (id INTEGER PRIMARY KEY, version_id INTEGER, is_applied BOOLEAN);
+		INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, true), (3, true);`); err != nil {
+		t.Fatalf("failed to create the migrations table: %+v", err)
+	}
+	_ = db.Close()
+
+	_, err = RestoreSqlite(t.Context(), snapshotPath, t.TempDir()+"/restored.db")
+	if err == nil || !strings.Contains(err.Error(), "snapshot schema version 3 is incompatible") {
+		t.Errorf("expected an incompatible schema version error, got %v", err)
+	}
+}
+
+func TestCheckFresh(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	admin := embeddfga.Tuple{Object: "app:auth", Relation: "admin", User: "user:test@example.com"}
+	// populate the check query cache with a denial
+	if v, err := conn.Check(t.Context(), admin); err != nil || v {
+		t.Fatalf("expected the admin check to be denied, got %v, %+v", v, err)
+	}
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{admin}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+	if v, err := conn.CheckFresh(t.Context(), admin); err != nil || !v {
+		t.Errorf("expected the fresh admin check to be allowed, got %v, %+v", v, err)
+	}
+}
+
+func TestAddTuplesSplitsLargeBatches(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	var tuples []embeddfga.Tuple
+	for i := range 250 {
+		tuples = append(tuples, embeddfga.Tuple{Object: "document:1", Relation: "viewer", User: fmt.Sprintf("user:%d@example.com", i)})
+	}
+	if err := conn.AddTuples(t.Context(), tuples); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+	for _, tpl := range tuples {
+		if v, err := conn.Check(t.Context(), tpl); err != nil || !v {
+			t.Fatalf("expected %s to be allowed, got %v, %+v", tpl, v, err)
+		}
+	}
+}
+
+func TestWaitForTuple(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	admin := embeddfga.Tuple{Object: "app:auth", Relation: "admin", User: "user:test@example.com"}
+	if err := conn.WaitForTuple(t.Context(), admin, 50*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a timeout for a tuple never written, got %+v", err)
+	}
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{admin}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+	if err := conn.WaitForTuple(t.Context(), admin, time.Second); err != nil {
+		t.Errorf("expected the written tuple to become visible, got %+v", err)
+	}
+}
+
+func TestNewEmbeddedSqliteEmptyModel(t *testing.T) {
+	_, err := NewEmbeddedSqlite(t.Context(), t.TempDir()+"/openfga.db", []byte(" \n\t"), "TEST_STORE")
+	if err == nil || !strings.Contains(err.Error(), "model data is empty") {
+		t.Fatalf("expected an empty model error, got %+v", err)
+	}
+}
+
+func TestCheckString(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:alice@example.com"},
+	}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	for rel, want := range map[string]bool{
+		"document:1#viewer@user:alice@example.com":    true,
+		" document:1#editor@user:alice@example.com\n": true,
+		"document:2#viewer@user:alice@example.com":    false,
+		"document:1#viewer@user:bob@example.com":      false,
+	} {
+		if v, err := conn.CheckString(t.Context(), rel); err != nil || v != want {
+			t.Errorf("CheckString(%q) = %v, %+v, want %v", rel, v, err, want)
+		}
+	}
+	for _, rel := range []string{"", "document:1", "document:1#viewer", "document:1#viewer@"} {
+		if _, err := conn.CheckString(t.Context(), rel); err == nil {
+			t.Errorf("expected CheckString(%q) to fail", rel)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	r, err := conn.Server().ReadAuthorizationModel(t.Context(), &openfgav1.ReadAuthorizationModelRequest{
+		StoreId: conn.StoreID(),
+		Id:      conn.AuthorizationModelID(),
+	})
+	if err != nil {
+		t.Fatalf("failed to read the authorization model through the server: %+v", err)
+	}
+	if r.GetAuthorizationModel().GetId() != conn.AuthorizationModelID() {
+		t.Errorf("expected the model %s, got %s", conn.AuthorizationModelID(), r.GetAuthorizationModel().GetId())
+	}
 }
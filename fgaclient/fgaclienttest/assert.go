@@ -0,0 +1,32 @@
+// Package fgaclienttest provides test helpers for the code using fgaclient, kept apart so that the fgaclient
+// package does not link the testing package into the binaries importing it.
+package fgaclienttest
+
+import (
+	"testing"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	"github.com/amikos-tech/embedded-openfga/fgaclient"
+)
+
+// CheckCase is an expected Check outcome for AssertChecks.
+type CheckCase struct {
+	Tuple embeddfga.Tuple
+	Want  bool
+}
+
+// AssertChecks runs the Check of every case and reports each failed Check and each decision differing from
+// Want as a test error, so an authorization test can list its allow and deny cases in a table.
+func AssertChecks(t testing.TB, c *fgaclient.Conn, cases []CheckCase) {
+	t.Helper()
+	for _, cc := range cases {
+		got, err := c.Check(t.Context(), cc.Tuple)
+		if err != nil {
+			t.Errorf("Check(%s#%s@%s) failed: %+v", cc.Tuple.Object, cc.Tuple.Relation, cc.Tuple.User, err)
+			continue
+		}
+		if got != cc.Want {
+			t.Errorf("Check(%s#%s@%s) = %v, want %v", cc.Tuple.Object, cc.Tuple.Relation, cc.Tuple.User, got, cc.Want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package fgaclienttest
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+	"github.com/amikos-tech/embedded-openfga/fgaclient"
+)
+
+// recordingTB records the errors reported through it instead of failing the test.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertChecks(t *testing.T) {
+	modelData, err := os.ReadFile("../../model.fga")
+	if err != nil {
+		t.Fatalf("failed to read the model file: %+v", err)
+	}
+	conn, err := fgaclient.NewEmbeddedSqlite(t.Context(), t.TempDir()+"/openfga.db", modelData, "TEST_STORE")
+	if err != nil {
+		t.Fatalf("failed to create embedded OpenFGA server: %+v", err)
+	}
+	defer conn.Close()
+	if err := conn.AddTuples(t.Context(), []embeddfga.Tuple{
+		{Object: "document:1", Relation: "editor", User: "user:test@example.com"},
+	}); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	AssertChecks(t, conn, []CheckCase{
+		{Tuple: embeddfga.Tuple{Object: "document:1", Relation: "viewer", User: "user:test@example.com"}, Want: true},
+		{Tuple: embeddfga.Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}, Want: false},
+	})
+
+	rec := &recordingTB{TB: t}
+	AssertChecks(rec, conn, []CheckCase{
+		{Tuple: embeddfga.Tuple{Object: "document:1", Relation: "editor", User: "user:another@example.com"}, Want: true},
+		{Tuple: embeddfga.Tuple{Object: "document:1", Relation: "unknown", User: "user:test@example.com"}, Want: true},
+	})
+	if len(rec.errors) != 2 || !strings.Contains(rec.errors[0], "Check(document:1#editor@user:another@example.com) = false, want true") ||
+		!strings.Contains(rec.errors[1], "failed") {
+		t.Errorf("expected a mismatch and a failed Check to be reported, got %q", rec.errors)
+	}
+}
@@ -0,0 +1,90 @@
+package fgaclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/grpc"
+)
+
+// errListObjectsLimitReached stops the streamed ListObjects evaluation once enough objects are collected.
+var errListObjectsLimitReached = errors.New("list objects limit reached")
+
+// listObjectsStream is the in-process stream of StreamedListObjects, it hands each object to send.
+type listObjectsStream struct {
+	grpc.ServerStream // only Context and Send are used by the server
+	ctx               context.Context
+	send              func(object string) error
+}
+
+func (s *listObjectsStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *listObjectsStream) Send(r *openfgav1.StreamedListObjectsResponse) error {
+	return s.send(r.GetObject())
+}
+
+// streamListObjects runs StreamedListObjects and hands each object to send, the evaluation stops at the first
+// error returned by send.
+func (c *Conn) streamListObjects(ctx context.Context, objectType, relation, user string, send func(object string) error) error {
+	// cancelling the context stops the evaluation still running when send stops the stream
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return c.fgaServer.StreamedListObjects(&openfgav1.StreamedListObjectsRequest{
+		StoreId:              c.storeID,
+		AuthorizationModelId: c.authorizationModelID,
+		Type:                 objectType,
+		Relation:             relation,
+		User:                 user,
+	}, &listObjectsStream{ctx: ctx, send: send})
+}
+
+// ListObjectsLimited returns at most limit objects of objectType the user has the relation with, e.g. the first
+// 20 documents a user can view. The objects are streamed and the evaluation stops once limit objects are
+// collected, so the server does not compute the full result set. The order of the objects is not defined.
+func (c *Conn) ListObjectsLimited(ctx context.Context, objectType, relation, user string, limit int) ([]string, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be greater than 0")
+	}
+	var objects []string
+	err := c.streamListObjects(ctx, objectType, relation, user, func(object string) error {
+		if len(objects) >= limit {
+			return errListObjectsLimitReached
+		}
+		objects = append(objects, object)
+		if len(objects) >= limit {
+			return errListObjectsLimitReached
+		}
+		return nil
+	})
+	// the server reports the error of send as an internal error, the collected count tells the limit was reached
+	if err != nil && len(objects) < limit {
+		return nil, fmt.Errorf("failed to list objects in OpenFGA: %w", err)
+	}
+	return objects, nil
+}
+
+// StreamListObjects sends the objects of objectType the user has the relation with to out as soon as they are
+// resolved, so large result sets are never held in memory. It blocks until all the objects are sent or ctx is
+// cancelled, which stops the evaluation early. out is closed when StreamListObjects returns.
+func (c *Conn) StreamListObjects(ctx context.Context, objectType, relation, user string, out chan<- string) error {
+	defer close(out)
+	err := c.streamListObjects(ctx, objectType, relation, user, func(object string) error {
+		select {
+		case out <- object:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stream objects from OpenFGA: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package fgaclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/amikos-tech/embedded-openfga/embeddfga"
+)
+
+func TestListObjectsLimited(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	var tuples []embeddfga.Tuple
+	for i := range 50 {
+		tuples = append(tuples, embeddfga.Tuple{Object: fmt.Sprintf("document:%d", i), Relation: "viewer", User: "user:test@example.com"})
+	}
+	if err := conn.AddTuples(t.Context(), tuples); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	objects, err := conn.ListObjectsLimited(t.Context(), "document", "viewer", "user:test@example.com", 20)
+	if err != nil {
+		t.Fatalf("failed to list objects: %+v", err)
+	}
+	if len(objects) != 20 {
+		t.Errorf("expected 20 objects, got %d: %v", len(objects), objects)
+	}
+
+	objects, err = conn.ListObjectsLimited(t.Context(), "document", "viewer", "user:test@example.com", 100)
+	if err != nil {
+		t.Fatalf("failed to list objects: %+v", err)
+	}
+	if len(objects) != 50 {
+		t.Errorf("expected all the 50 objects below the limit, got %d", len(objects))
+	}
+
+	if _, err := conn.ListObjectsLimited(t.Context(), "document", "viewer", "user:test@example.com", 0); err == nil {
+		t.Error("expected an error for a zero limit")
+	}
+}
+
+func TestStreamListObjects(t *testing.T) {
+	conn := newTestConn(t, t.TempDir()+"/openfga.db")
+
+	var tuples []embeddfga.Tuple
+	for i := range 50 {
+		tuples = append(tuples, embeddfga.Tuple{Object: fmt.Sprintf("document:%d", i), Relation: "viewer", User: "user:test@example.com"})
+	}
+	if err := conn.AddTuples(t.Context(), tuples); err != nil {
+		t.Fatalf("failed to add tuples: %+v", err)
+	}
+
+	out := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- conn.StreamListObjects(t.Context(), "document", "viewer", "user:test@example.com", out)
+	}()
+	seen := map[string]bool{}
+	for object := range out {
+		seen[object] = true
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to stream objects: %+v", err)
+	}
+	if len(seen) != 50 {
+		t.Errorf("expected 50 objects, got %d", len(seen))
+	}
+
+	// stop reading after the first object
+	ctx, cancel := context.WithCancel(t.Context())
+	out = make(chan string)
+	go func() {
+		errc <- conn.StreamListObjects(ctx, "document", "viewer", "user:test@example.com", out)
+	}()
+	<-out
+	cancel()
+	for range out {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled stream to return context.Canceled, got %+v", err)
+	}
+}